@@ -1,20 +1,31 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 
 package main
 
 import (
-	"compress/gzip"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"time"
 )
 
 type Archive interface {
 	// Returns the path name of the archive.
 	Name() string
-	// Finishes the archive.
+	// Returns the path name the archive is written to until committed.
+	TempName() string
+	// Finishes the archive, under its temporary name.
 	Close() error
+	// Moves the closed archive into place under its name.
+	Commit() error
+	// Discards the archive after a failure.
+	Abort() error
 	// Flush the current state of data.
 	Flush() error
 	// AddFS adds the files from fs.FS to the archive. It walks the directory
@@ -23,11 +34,12 @@ type Archive interface {
 	AddFS(fsys fs.FS) error
 	// Creates a file entry. Data is copied from `fp` into the archive as `name`
 	// based on the original information provided in `stat`. Name should refer
-	// to the desired path in the archive (e.g., subdir/foo) and for openning
-	// from the current directory. It is expected that any parent directories
-	// relevant to `name` have already been created with AddDir(). The caller is
-	// responsible for closing fp.
-	AddFile(fp io.Reader, stat fs.FileInfo, name string) error
+	// to the desired path in the archive (e.g., subdir/foo), while `source`
+	// refers to the file on disk, relative to the current directory, such as
+	// for reading the target of a symbolic link. It is expected that any parent
+	// directories relevant to `name` have already been created with AddDir().
+	// The caller is responsible for closing fp.
+	AddFile(fp io.Reader, stat fs.FileInfo, source, name string) error
 	// Creates a directory entry. A directory record is added to the archive as
 	// `name` using the original information provided by `stat`. This is a non
 	// recursive operation, and it is expected that any parent directory already
@@ -35,19 +47,247 @@ type Archive interface {
 	AddDir(dp fs.DirEntry, stat fs.FileInfo, name string) error
 }
 
+// Reads back the members of an archive in order, like tar.Reader.
+type ArchiveReader interface {
+	// Returns the path name of the archive.
+	Name() string
+	// Releases the archive.
+	Close() error
+	// Advances to the next member of the archive, returning io.EOF once there
+	// are no more members.
+	Next() (*ArchiveEntry, error)
+	// Reads from the contents of the current member. Integrity checks offered
+	// by the format are verified upon reaching the end of the contents.
+	Read(p []byte) (int, error)
+}
+
+// Describes a member of an archive being read.
+type ArchiveEntry struct {
+	// Path name of the member within the archive.
+	Name string
+	// Type and permission bits.
+	Mode fs.FileMode
+	// Size of the contents in bytes.
+	Size int64
+	// Modification time.
+	ModTime time.Time
+	// Target of a symbolic link, or the name of the member a hard link refers
+	// to when HardLink is set.
+	Linkname string
+	HardLink bool
+	// Ownership, where the format records it.
+	Uid, Gid     int
+	Uname, Gname string
+	HasOwner     bool
+}
+
+// Describes an archive format that can be created and read back.
+type ArchiveFormat struct {
+	// Names accepted for the format field of a BackupSpec. The first is the
+	// canonical name.
+	Names []string
+	// Identifying bytes found at MagicOffset into the file.
+	Magic       []byte
+	MagicOffset int
+	// Creates an archive at the path name.
+	Create func(name string, opts *ArchiveOptions) (Archive, error)
+	// Opens the archive at the path name for reading.
+	Open func(name string) (ArchiveReader, error)
+}
+
+// Options for creating an archive.
+type ArchiveOptions struct {
+	// Passed to the compressor, if any, with zero meaning the default level
+	// of the compression format.
+	Level int
+	// How many goroutines to compress on. Zero and one both mean compressing
+	// as a single stream, and only formats with a parallel filter support
+	// more.
+	Threads int
+	// Where messages go.
+	Log *Logger
+}
+
+// Returned when creating an archive with more threads than its format supports.
+var errThreads = errors.New("threads: compressing on more than one thread is only supported by the tgz and tzst formats")
+
+// Returned when creating an archive with a compression level that its format
+// doesn't have.
+var errLevel = errors.New("level: a compression level is only supported by the tgz, tzst, txz, tbz2, and repo formats")
+
+// Returns an error if the options ask for more threads than a format without
+// parallel compression supports.
+func (opts *ArchiveOptions) singleThreaded() error {
+	if opts.Threads < 0 {
+		return fmt.Errorf("invalid threads: %d", opts.Threads)
+	} else if opts.Threads > 1 {
+		return errThreads
+	}
+	return nil
+}
+
+// Returns an error if the options set a compression level for a format that
+// doesn't have one.
+func (opts *ArchiveOptions) noLevel() error {
+	if opts.Level != 0 {
+		return errLevel
+	}
+	return nil
+}
+
+// Returns a function creating a tar archive compressed by the filter that
+// newFilter returns for the level, or that newParallelFilter returns for the
+// level and threads when there's more than one. Without a newFilter, the tar
+// isn't compressed and there's no level.
+func createTar(newFilter func(int) (FilterFunc, error), newParallelFilter func(int, int) (FilterFunc, error)) func(string, *ArchiveOptions) (Archive, error) {
+	return func(name string, opts *ArchiveOptions) (Archive, error) {
+		if newFilter == nil {
+			if err := opts.noLevel(); err != nil {
+				return nil, err
+			}
+		}
+		var filter FilterFunc
+		var err error
+		if opts.Threads > 1 && newParallelFilter != nil {
+			filter, err = newParallelFilter(opts.Level, opts.Threads)
+		} else if err = opts.singleThreaded(); err == nil && newFilter != nil {
+			filter, err = newFilter(opts.Level)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return NewTarArchive(name, filter, opts.Log)
+	}
+}
+
+// Returns a function opening a tar archive decompressed by unfilter.
+func openTar(unfilter UnfilterFunc) func(string) (ArchiveReader, error) {
+	return func(name string) (ArchiveReader, error) {
+		return OpenTarArchive(name, unfilter)
+	}
+}
+
+// The supported archive formats. Formats are detected in this order, so plain
+// tar, with its magic in the middle of the first header, goes first.
+var ArchiveFormats = []*ArchiveFormat{
+	{
+		Names:       []string{FormatTar},
+		Magic:       []byte("ustar"),
+		MagicOffset: 257,
+		Create:      createTar(nil, nil),
+		Open:        openTar(nil),
+	},
+	{
+		Names:  []string{FormatTGZ, FormatTarGz},
+		Magic:  []byte{0x1f, 0x8b},
+		Create: createTar(NewGzipFilter, NewParallelGzipFilter),
+		Open:   openTar(NewGzipUnfilter),
+	},
+	{
+		Names:  []string{FormatTZST, FormatTarZst},
+		Magic:  []byte{0x28, 0xb5, 0x2f, 0xfd},
+		Create: createTar(NewZstdFilter, NewParallelZstdFilter),
+		Open:   openTar(NewZstdUnfilter),
+	},
+	{
+		Names:  []string{FormatTXZ, FormatTarXz},
+		Magic:  []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		Create: createTar(NewXzFilter, nil),
+		Open:   openTar(NewXzUnfilter),
+	},
+	{
+		Names:  []string{FormatTBZ2, FormatTarBz2},
+		Magic:  []byte("BZh"),
+		Create: createTar(NewBzip2Filter, nil),
+		Open:   openTar(NewBzip2Unfilter),
+	},
+	{
+		Names: []string{FormatZip},
+		// Local file header, or the end of central directory of an empty zip.
+		Magic: []byte("PK"),
+		Create: func(name string, opts *ArchiveOptions) (Archive, error) {
+			if err := opts.singleThreaded(); err != nil {
+				return nil, err
+			}
+			if err := opts.noLevel(); err != nil {
+				return nil, err
+			}
+			return NewZipArchive(name, opts.Log)
+		},
+		Open: func(name string) (ArchiveReader, error) {
+			return OpenZipArchive(name)
+		},
+	},
+	{
+		Names: []string{FormatRepo},
+		// The start of a snapshot manifest. Repositories themselves are
+		// directories, which DetectFormat checks for separately.
+		Magic: []byte(`{"format":"` + RepoSnapshotFormat + `"`),
+		Create: func(name string, opts *ArchiveOptions) (Archive, error) {
+			if err := opts.singleThreaded(); err != nil {
+				return nil, err
+			}
+			return NewRepoArchive(name, opts.Level, opts.Log)
+		},
+		Open: func(name string) (ArchiveReader, error) {
+			return OpenRepoArchive(name)
+		},
+	},
+}
+
+// Returns the format registered under name.
+func LookupFormat(name string) (*ArchiveFormat, error) {
+	for _, format := range ArchiveFormats {
+		if slices.Contains(format.Names, name) {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported backup format: %s", name)
+}
+
+// Returns the format of the archive at the path name based on its contents,
+// regardless of the file extension.
+func DetectFormat(name string) (*ArchiveFormat, error) {
+	if IsRepository(name) {
+		return LookupFormat(FormatRepo)
+	}
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(fp, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	header = header[:n]
+	for _, format := range ArchiveFormats {
+		end := format.MagicOffset + len(format.Magic)
+		if end <= len(header) && bytes.Equal(header[format.MagicOffset:end], format.Magic) {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: unrecognized archive format", name)
+}
+
 // Factory function returning the correct Archive implementation for format.
-func CreateArchive(name, format string) (Archive, error) {
-	switch format {
-	case FormatTar:
-		return NewTarArchive(name, nil)
-	case FormatTGZ, FormatTarGz:
-		filter := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
-		return NewTarArchive(name, filter)
-	case FormatZip:
-		return NewZipArchive(name)
-	default:
-		return nil, fmt.Errorf("unsupported backup format: %s", format)
+func CreateArchive(name, format string, opts *ArchiveOptions) (Archive, error) {
+	f, err := LookupFormat(format)
+	if err != nil {
+		return nil, err
 	}
+	return f.Create(name, opts)
+}
+
+// Opens the archive at the path name for reading, detecting its format.
+func OpenArchive(name string) (ArchiveReader, error) {
+	format, err := DetectFormat(name)
+	if err != nil {
+		return nil, err
+	}
+	Debugf("OpenArchive(): %s detected as %s", name, format.Names[0])
+	return format.Open(name)
 }
 
 // Returns a string formatted in the form "archive name:file name" suitable to
@@ -67,3 +307,19 @@ func CopyData(dst io.Writer, dname string, src io.Reader, sname string) error {
 	}
 	return nil
 }
+
+// Describes contents that don't come from a file on disk, such as a manifest
+// generated during a backup, for passing to Archive.AddFile.
+type SyntheticFileInfo struct {
+	FileName    string
+	FileSize    int64
+	FileMode    fs.FileMode
+	FileModTime time.Time
+}
+
+func (fi *SyntheticFileInfo) Name() string       { return path.Base(fi.FileName) }
+func (fi *SyntheticFileInfo) Size() int64        { return fi.FileSize }
+func (fi *SyntheticFileInfo) Mode() fs.FileMode  { return fi.FileMode }
+func (fi *SyntheticFileInfo) ModTime() time.Time { return fi.FileModTime }
+func (fi *SyntheticFileInfo) IsDir() bool        { return fi.FileMode.IsDir() }
+func (fi *SyntheticFileInfo) Sys() any           { return nil }
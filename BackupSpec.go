@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 
 package main
 
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,19 +18,244 @@ import (
 type BackupSpec struct {
 	// Name of the backup job for debugging.
 	Name string `yaml:"name" json:"name"`
-	// Path to the output archive
+	// Path to the output archive. May be a template, see PathTemplateData.
 	Path string `yaml:"path" json:"path"`
 	// Which format to use for path.
 	Format string `yaml:"format" json:"format"`
+	// Compression level for compressed formats. Zero means the default.
+	Level int `yaml:"level" json:"level"`
+	// Compress on this many threads, for the formats that can. Zero and one
+	// both mean compressing as a single stream.
+	Threads int `yaml:"threads" json:"threads"`
+	// Read small files ahead on this many goroutines while writing the
+	// archive. Zero and one both mean reading each file as it's written.
+	Readers int `yaml:"readers" json:"readers"`
+	// Path to write a JSON report of the backup to, see BackupReport.
+	Report string `yaml:"report" json:"report"`
 	// What to stuff in the archive.
-	Contents []string `yaml:"contents" json:"contents"`
+	Contents []Content `yaml:"contents" json:"contents"`
+	// Glob patterns for files to archive. When empty, everything is.
+	Include []string `yaml:"include" json:"include"`
+	// Glob patterns for files and directories to leave out.
+	Exclude []string `yaml:"exclude" json:"exclude"`
+	// Names of per-directory ignore files to honor, e.g., ".gitignore".
+	IgnoreFiles []string `yaml:"ignore_files" json:"ignore_files"`
+	// Leading path removed from the names of contents without an "as".
+	StripPrefix string `yaml:"strip_prefix" json:"strip_prefix"`
+	// Remove the leading slash from absolute names in the archive.
+	StripLeadingSlash bool `yaml:"strip_leading_slash" json:"strip_leading_slash"`
+	// Top-level directory to place every member of the archive under.
+	Prefix string `yaml:"prefix" json:"prefix"`
+	// Read back and check the archive once it has been written.
+	Verify bool `yaml:"verify" json:"verify"`
+	// Record checksums of the archived files, if not nil.
+	Manifest *ManifestSpec `yaml:"manifest" json:"manifest"`
+	// State file for incremental or differential backups, if not empty. Only
+	// what changed since the backup it refers to is archived.
+	Snapshot string `yaml:"snapshot" json:"snapshot"`
+	// Either ModeIncremental or ModeDifferential. Defaults to the former when
+	// there is a snapshot.
+	Mode string `yaml:"mode" json:"mode"`
+	// Archive everything even if there is a snapshot, starting a new chain.
+	Full bool `yaml:"full" json:"full"`
+	// Which older archives to keep, if not nil.
+	Retention *RetentionSpec `yaml:"retention" json:"retention"`
+	// What to do when something can't be archived: OnErrorAbort,
+	// OnErrorContinue, or OnErrorSkipFile. Defaults to the former.
+	OnError string `yaml:"on_error" json:"on_error"`
+	// Shell commands to run before the backup. If one fails, the backup does
+	// too, without running the rest.
+	Before []string `yaml:"before" json:"before"`
+	// Shell commands to run after the backup, whether or not it succeeded.
+	After []string `yaml:"after" json:"after"`
+	// Shell commands to run once the backup has failed.
+	OnFailure []string `yaml:"on_failure" json:"on_failure"`
+	// How long each of the above may run, e.g., "90s". Defaults to
+	// DefaultHookTimeout.
+	HookTimeout string `yaml:"hook_timeout" json:"hook_timeout"`
 }
 
 const (
-	FormatTGZ   = "tgz"
-	FormatTar   = "tar"
-	FormatTarGz = "tar.gz"
-	FormatZip   = "zip"
+	// Fail the backup, and don't run any more.
+	OnErrorAbort = "abort"
+	// Fail the backup, but go on with the rest.
+	OnErrorContinue = "continue"
+	// Leave out files that can't be read, and go on with the rest of the
+	// backups if anything else fails.
+	OnErrorSkipFile = "skip-file"
+)
+
+const (
+	// Archive what changed since the previous backup.
+	ModeIncremental = "incremental"
+	// Archive what changed since the last full backup.
+	ModeDifferential = "differential"
+)
+
+// Returns the mode of the backup, or an empty string if it isn't incremental
+// or differential.
+func (spec *BackupSpec) SnapshotMode() string {
+	if spec.Mode == "" && spec.Snapshot != "" {
+		return ModeIncremental
+	}
+	return spec.Mode
+}
+
+// Returns the path of the snapshot state file. Differential backups default to
+// an index of the full backup next to the archive, named after the spec. The
+// spec's path must be its template, not expanded, so that each backup finds
+// the same index. If the index's path would come from the template, there's no
+// default and this returns "".
+func (spec *BackupSpec) SnapshotPath() string {
+	if spec.Snapshot != "" || spec.SnapshotMode() != ModeDifferential {
+		return spec.Snapshot
+	}
+	dir := path.Dir(spec.Path)
+	name := spec.Name
+	if name == "" {
+		name = strings.SplitN(path.Base(spec.Path), ".", 2)[0]
+		if strings.Contains(name, "{{") {
+			return ""
+		}
+	}
+	if strings.Contains(dir, "{{") {
+		return ""
+	}
+	name = strings.ReplaceAll(name, "/", "_")
+	return path.Join(dir, name+".full.json")
+}
+
+// Describes the checksums recorded for a backup.
+type ManifestSpec struct {
+	// Hash algorithms to use: sha256, sha512, or blake2b. Defaults to sha256.
+	Algorithms []string `yaml:"algorithms" json:"algorithms"`
+	// Where the checksums of the archived files go. Either ManifestSidecar or
+	// ManifestMember, defaulting to the former.
+	Location string `yaml:"location" json:"location"`
+}
+
+// How many of a spec's archives to keep. An archive is kept if any of the
+// counts selects it, and the others are removed after a successful backup.
+type RetentionSpec struct {
+	// Keep the last N archives.
+	KeepLast int `yaml:"keep_last" json:"keep_last"`
+	// Keep the last archive of each of the last N days, weeks, months, and
+	// years that have one.
+	KeepDaily   int `yaml:"keep_daily" json:"keep_daily"`
+	KeepWeekly  int `yaml:"keep_weekly" json:"keep_weekly"`
+	KeepMonthly int `yaml:"keep_monthly" json:"keep_monthly"`
+	KeepYearly  int `yaml:"keep_yearly" json:"keep_yearly"`
+	// Glob pattern matching the spec's archives. Defaults to the path, with
+	// any times in its template matching anything.
+	Pattern string `yaml:"pattern" json:"pattern"`
+}
+
+const (
+	// Write <archive>.<algorithm> files next to the archive.
+	ManifestSidecar = "sidecar"
+	// Add a MANIFEST member at the end of the archive.
+	ManifestMember = "member"
+	// Name of the manifest member, under the spec's prefix if any.
+	ManifestMemberName = "MANIFEST"
+)
+
+// Something to put in the archive. May be given as just the path.
+type Content struct {
+	// File or directory to archive.
+	Path string `yaml:"path" json:"path"`
+	// Shell command whose standard output is archived as a file, in place of
+	// Path. Requires As.
+	Command string `yaml:"command" json:"command"`
+	// Name to archive Path as, in place of Path. The contents of a directory
+	// are archived beneath this name.
+	As string `yaml:"as" json:"as"`
+}
+
+// Returns an error if the content doesn't have either a path or a command
+// with a name to archive it as.
+func (c *Content) Validate() error {
+	switch {
+	case c.Command != "" && c.Path != "":
+		return fmt.Errorf("content has both a path and a command: %s", c.Command)
+	case c.Command != "" && c.As == "":
+		return fmt.Errorf("content command needs an as: %s", c.Command)
+	case c.Command == "" && c.Path == "":
+		return fmt.Errorf("content needs a path or a command")
+	}
+	return nil
+}
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.Path); err == nil {
+		return nil
+	}
+	// Use a distinct type so this method isn't called recursively.
+	type content Content
+	return json.Unmarshal(data, (*content)(c))
+}
+
+func (c *Content) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&c.Path)
+	}
+	type content Content
+	return value.Decode((*content)(c))
+}
+
+// Returns the name to record in the archive for path, which is either the
+// content's path or something found beneath it. For a command, it's the
+// content's as.
+func (spec *BackupSpec) ArchiveName(content Content, name string) string {
+	if content.Command != "" {
+		name = content.As
+	} else if content.As != "" {
+		name = path.Join(content.As, relativePath(content.Path, name))
+	} else if spec.StripPrefix != "" {
+		prefix := strings.TrimSuffix(spec.StripPrefix, "/")
+		if name == prefix {
+			name = ""
+		} else if strings.HasPrefix(name, prefix+"/") {
+			name = name[len(prefix)+1:]
+		}
+	}
+	if spec.StripLeadingSlash {
+		name = strings.TrimLeft(name, "/")
+	}
+	if spec.Prefix != "" {
+		name = path.Join(spec.Prefix, name)
+	}
+	if name == "" {
+		name = "."
+	}
+	return name
+}
+
+// Returns name relative to dir, which it's either the same as or beneath, by
+// whole path elements. Returns an empty string if name is dir.
+func relativePath(dir, name string) string {
+	dir, name = path.Clean(dir), path.Clean(name)
+	if name == dir {
+		return ""
+	}
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+const (
+	FormatTGZ    = "tgz"
+	FormatTar    = "tar"
+	FormatTarGz  = "tar.gz"
+	FormatTZST   = "tzst"
+	FormatTarZst = "tar.zst"
+	FormatTXZ    = "txz"
+	FormatTarXz  = "tar.xz"
+	FormatTBZ2   = "tbz2"
+	FormatTarBz2 = "tar.bz2"
+	FormatZip    = "zip"
+	FormatRepo   = "repo"
 )
 
 func UnmarshalBackupSpecs(data []byte) ([]BackupSpec, error) {
@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024-2025, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 
 package main
 
@@ -22,6 +22,14 @@ type Options struct {
 	LogLevel LogLevel
 	// Perform a dry run.
 	DryRun bool
+	// Start a new chain for specs with a snapshot, rather than an incremental.
+	Full bool
+	// How many backups to run at once.
+	Jobs int
+	// Report the progress of backups.
+	Progress bool
+	// Write a JSON report of the backups to this path.
+	Report string
 	// Flag set for parsing the above options.
 	FlagSet *flag.FlagSet
 }
@@ -41,13 +49,25 @@ func NewOptions() *Options {
 		opts.LogLevel, err = ParseLogLevel(arg)
 		return err
 	})
-	fs.BoolVar(&opts.DryRun, "dry-run", false, "")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Show what would be done without writing anything.")
+	fs.BoolVar(&opts.Full, "full", false, "Perform full backups of specs with a snapshot, starting new incremental chains.")
+	fs.BoolVar(&opts.Progress, "progress", false, "Report progress, throughput, and the time remaining while backing up.")
+	fs.StringVar(&opts.Report, "report", "", "Write a JSON report of every backup to `FILE`.")
+	fs.IntVar(&opts.Jobs, "jobs", 1, "Run up to `N` backups at once, prefixing their messages with the spec name.")
 	fs.Usage = func() {
 		out := fs.Output()
 		io.WriteString(out, fmt.Sprintf("usage: %s [options] [file ...]\n", opts.Name()))
+		io.WriteString(out, fmt.Sprintf("       %s [options] command [command options] [args ...]\n", opts.Name()))
 		io.WriteString(out, "\nOptions:\n\n")
 		fs.PrintDefaults()
 		io.WriteString(out, "\nEach file is parsed to define the backup archive(s) to create. Defaults to reading from standard input.\n")
+		io.WriteString(out, "The exit status is 0 on success, 1 if a backup failed, and 2 if files were skipped.\n")
+		io.WriteString(out, "\nCommands:\n\n")
+		io.WriteString(out, "  list archive\n    \tList the contents of an archive, or the snapshots of a repository.\n")
+		io.WriteString(out, "  prune repository [snapshot ...]\n    \tRemove snapshots and unused data from a repository.\n")
+		io.WriteString(out, "  restore archive [dest]\n    \tRestore the contents of an archive.\n")
+		io.WriteString(out, "  verify archive ...\n    \tVerify the integrity of archives.\n")
+		io.WriteString(out, "\nUse '-h' after a command for its options.\n")
 	}
 	opts.FlagSet = fs
 	return &opts
@@ -57,6 +77,9 @@ func NewOptions() *Options {
 // error resulted.
 func (opt *Options) MustParseArgs() {
 	err := opt.ParseArgs()
+	if err == nil && opt.Jobs < 1 {
+		err = fmt.Errorf("invalid value %d for -jobs: must be at least 1", opt.Jobs)
+	}
 	if err != nil {
 		opt.ExitUsageError(err)
 	} else if opt.Help {
@@ -95,3 +118,30 @@ func (opt *Options) Name() string {
 func (opt *Options) Args() []string {
 	return opt.FlagSet.Args()
 }
+
+// Returns a flag set for the named subcommand. The synopsis describes the
+// arguments following the options, and the description what the command does.
+// Parse it with ParseCommand.
+func (opt *Options) NewCommandFlagSet(name, synopsis, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		io.WriteString(out, fmt.Sprintf("usage: %s [options] %s [%s options] %s\n", opt.Name(), name, name, synopsis))
+		io.WriteString(out, "\n"+description+"\n")
+		io.WriteString(out, "\nOptions:\n\n")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Parses the arguments of a subcommand, exiting if help was requested or an
+// error resulted.
+func (opt *Options) ParseCommand(fs *flag.FlagSet, args []string) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		// The flag package has already reported the error and usage.
+		os.Exit(64) // EX_USAGE.
+	}
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Decides which paths found while walking the contents of a backup should be
+// archived, based on the include and exclude patterns of a BackupSpec.
+type PathFilter struct {
+	// Paths matching any of these are archived, if there are any.
+	Include []string
+	// Paths matching any of these are never archived.
+	Exclude []string
+}
+
+// Returns a new PathFilter after validating the patterns.
+func NewPathFilter(include, exclude []string) (*PathFilter, error) {
+	for _, list := range [][]string{include, exclude} {
+		for _, pattern := range list {
+			if err := ValidatePattern(pattern); err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return &PathFilter{Include: include, Exclude: exclude}, nil
+}
+
+// Returns the first exclude pattern matching name, or "" if it should not be
+// excluded. Directories that are excluded should not be descended into.
+func (pf *PathFilter) Excluded(name string, isDir bool) string {
+	for _, pattern := range pf.Exclude {
+		// Patterns were validated by NewPathFilter.
+		if ok, _ := MatchPattern(pattern, name, isDir); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// Reports whether the file name is included. Without include patterns
+// everything is. Otherwise name, or one of its parent directories, has to
+// match one of the patterns.
+func (pf *PathFilter) Included(name string) bool {
+	if len(pf.Include) == 0 {
+		return true
+	}
+	isDir := false
+	for {
+		for _, pattern := range pf.Include {
+			if ok, _ := MatchPattern(pattern, name, isDir); ok {
+				return true
+			}
+		}
+		parent := path.Dir(name)
+		if parent == name || parent == "." {
+			return false
+		}
+		name = parent
+		isDir = true
+	}
+}
+
+// Reports whether name matches the glob pattern. In addition to the syntax of
+// path.Match, a "**" element matches zero or more path elements. Patterns that
+// don't contain a slash are matched against the last element of name, in any
+// directory, so "*.tmp" and "node_modules" work as expected. Other patterns
+// must match the whole of name. A trailing slash only matches directories.
+func MatchPattern(pattern, name string, isDir bool) (bool, error) {
+	if strings.HasSuffix(pattern, "/") {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if !isDir {
+			return false, nil
+		}
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// Checks that the pattern is well formed for MatchPattern.
+func ValidatePattern(pattern string) error {
+	if pattern == "" || pattern == "/" {
+		return fmt.Errorf("empty pattern")
+	}
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches the path elements of name against those of a pattern.
+func matchElements(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated "**" and try every possible suffix of name.
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true, nil
+			}
+			for i := range name {
+				if ok, err := matchElements(pattern, name[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0, nil
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		isDir, want   bool
+	}{
+		{"*.tmp", "a.tmp", false, true},
+		{"*.tmp", "src/deep/a.tmp", false, true},
+		{"*.tmp", "a.tmp.txt", false, false},
+		{"node_modules/", "src/node_modules", true, true},
+		{"node_modules/", "src/node_modules", false, false},
+		{"src/*.go", "src/main.go", false, true},
+		{"src/*.go", "src/sub/main.go", false, false},
+		{"src/*.go", "other/src/main.go", false, false},
+		{"src/**/*.go", "src/main.go", false, true},
+		{"src/**/*.go", "src/a/b/main.go", false, true},
+		{"**/cache", "cache", true, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"/home/*/.cache", "/home/me/.cache", true, true},
+		{"/home/*/.cache", "/home/me/sub/.cache", true, false},
+		{"/home/**", "/home/me/file", false, true},
+	}
+	for _, test := range tests {
+		got, err := MatchPattern(test.pattern, test.name, test.isDir)
+		if err != nil {
+			t.Errorf("MatchPattern(%q, %q, %v): %v", test.pattern, test.name, test.isDir, err)
+		} else if got != test.want {
+			t.Errorf("MatchPattern(%q, %q, %v) = %v, want %v", test.pattern, test.name, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	for _, pattern := range []string{"", "/", "[", "a/[/b"} {
+		if _, err := NewPathFilter([]string{pattern}, nil); err == nil {
+			t.Errorf("NewPathFilter() accepted include pattern %q", pattern)
+		}
+		if _, err := NewPathFilter(nil, []string{pattern}); err == nil {
+			t.Errorf("NewPathFilter() accepted exclude pattern %q", pattern)
+		}
+	}
+
+	pf, err := NewPathFilter([]string{"/src/*/docs", "*.md"}, []string{"*.tmp", "build/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	excluded := []struct {
+		name  string
+		isDir bool
+		want  string
+	}{
+		{"/src/a/notes.tmp", false, "*.tmp"},
+		{"/src/a/build", true, "build/"},
+		{"/src/a/build", false, ""},
+		{"/src/a/docs", true, ""},
+	}
+	for _, test := range excluded {
+		if got := pf.Excluded(test.name, test.isDir); got != test.want {
+			t.Errorf("Excluded(%q, %v) = %q, want %q", test.name, test.isDir, got, test.want)
+		}
+	}
+	included := []struct {
+		name string
+		want bool
+	}{
+		{"/src/a/docs/index.html", true},
+		{"/src/a/docs/img/logo.png", true},
+		{"/src/a/README.md", true},
+		{"/src/a/main.go", false},
+		{"/src/docs/index.html", false},
+	}
+	for _, test := range included {
+		if got := pf.Included(test.name); got != test.want {
+			t.Errorf("Included(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	var everything PathFilter
+	if !everything.Included("/any/file") {
+		t.Errorf("a filter without include patterns doesn't include everything")
+	}
+}
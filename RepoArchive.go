@@ -0,0 +1,532 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// Name of the file identifying a directory as a repository.
+	RepoConfigName = "zephyr-repo.json"
+	// Value of the format field starting every snapshot manifest, which makes
+	// for the magic of the repo format.
+	RepoSnapshotFormat = "zephyr-snapshot"
+)
+
+// The configuration of a repository, fixed when it's created.
+type RepoConfig struct {
+	Version int `json:"version"`
+	// Chunker parameters, see NewChunker.
+	ChunkMin int `json:"chunk_min"`
+	ChunkAvg int `json:"chunk_avg"`
+	ChunkMax int `json:"chunk_max"`
+}
+
+// A directory of deduplicated, compressed chunks and the snapshots made of
+// them. Chunks are named by the SHA-256 of their uncompressed contents, under
+// chunks/, and each backup is a snapshot manifest under snapshots/.
+type Repository struct {
+	Path   string
+	Config RepoConfig
+}
+
+// A snapshot manifest, describing what one backup stored in a repository.
+type RepoSnapshot struct {
+	// Always RepoSnapshotFormat, and always first.
+	Format  string       `json:"format"`
+	ID      string       `json:"id"`
+	Time    time.Time    `json:"time"`
+	Members []RepoMember `json:"members"`
+}
+
+// A member of a snapshot. Its contents are the concatenation of its chunks.
+type RepoMember struct {
+	Name     string      `json:"name"`
+	Mode     fs.FileMode `json:"mode"`
+	Size     int64       `json:"size"`
+	ModTime  time.Time   `json:"mtime"`
+	Linkname string      `json:"linkname,omitempty"`
+	Uid      *int        `json:"uid,omitempty"`
+	Gid      *int        `json:"gid,omitempty"`
+	Uname    string      `json:"uname,omitempty"`
+	Gname    string      `json:"gname,omitempty"`
+	Chunks   []string    `json:"chunks,omitempty"`
+}
+
+// Reports whether dir is a repository.
+func IsRepository(dir string) bool {
+	_, err := os.Stat(path.Join(dir, RepoConfigName))
+	return err == nil
+}
+
+// Opens the existing repository at dir.
+func OpenRepository(dir string) (*Repository, error) {
+	data, err := os.ReadFile(path.Join(dir, RepoConfigName))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a repository: %w", dir, err)
+	}
+	repo := &Repository{Path: dir}
+	if err := json.Unmarshal(data, &repo.Config); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	if repo.Config.Version != 1 {
+		return nil, fmt.Errorf("%s: unsupported repository version %d", dir, repo.Config.Version)
+	}
+	return repo, nil
+}
+
+// Opens the repository at dir, creating it if it doesn't exist, which is
+// logged to log. During a dry run, nothing is created.
+func CreateRepository(log *Logger, dir string) (*Repository, error) {
+	if IsRepository(dir) {
+		return OpenRepository(dir)
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s: not a repository, and not empty", dir)
+	}
+	log.Infof("Creating repository %s", dir)
+	repo := &Repository{
+		Path: dir,
+		Config: RepoConfig{
+			Version:  1,
+			ChunkMin: 256 << 10,
+			ChunkAvg: 1 << 20,
+			ChunkMax: 4 << 20,
+		},
+	}
+	if options.DryRun {
+		return repo, nil
+	}
+	for _, sub := range []string{"chunks", "snapshots"} {
+		if err := os.MkdirAll(path.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.MarshalIndent(repo.Config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return repo, os.WriteFile(path.Join(dir, RepoConfigName), data, 0644)
+}
+
+// Returns the path of the chunk with the given ID.
+func (repo *Repository) ChunkPath(id string) string {
+	return path.Join(repo.Path, "chunks", id[:2], id)
+}
+
+// Returns the path of the snapshot manifest with the given ID.
+func (repo *Repository) SnapshotPath(id string) string {
+	return path.Join(repo.Path, "snapshots", id+".json")
+}
+
+// Returns the snapshots in the repository, oldest first.
+func (repo *Repository) Snapshots() ([]*RepoSnapshot, error) {
+	entries, err := os.ReadDir(path.Join(repo.Path, "snapshots"))
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []*RepoSnapshot
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		snapshot, err := ReadRepoSnapshot(repo.SnapshotPath(id))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Reads the snapshot manifest at the path name.
+func ReadRepoSnapshot(name string) (*RepoSnapshot, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot RepoSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if snapshot.Format != RepoSnapshotFormat {
+		return nil, fmt.Errorf("%s: not a snapshot manifest", name)
+	}
+	return &snapshot, nil
+}
+
+// Stores the chunk unless the repository already has it, returning its ID and
+// the number of bytes written.
+func (repo *Repository) PutChunk(data []byte, encoder *zstd.Encoder) (string, int64, error) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	name := repo.ChunkPath(id)
+	if _, err := os.Stat(name); err == nil {
+		return id, 0, nil
+	}
+	if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+		return "", 0, err
+	}
+	compressed := encoder.EncodeAll(data, nil)
+	// Another job may be storing the same chunk, so write a temporary file of
+	// our own and rename it into place.
+	fp, err := os.CreateTemp(path.Dir(name), id+".*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	_, err = fp.Write(compressed)
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(fp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+		return "", 0, err
+	}
+	return id, int64(len(compressed)), nil
+}
+
+// Returns the contents of the chunk with the given ID, verifying that they
+// match it.
+func (repo *Repository) GetChunk(id string, decoder *zstd.Decoder) ([]byte, error) {
+	compressed, err := os.ReadFile(repo.ChunkPath(id))
+	if err != nil {
+		return nil, err
+	}
+	data, err := decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", id, err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != id {
+		return nil, fmt.Errorf("chunk %s: checksum mismatch", id)
+	}
+	return data, nil
+}
+
+// Writes a new snapshot to a repository. The snapshot manifest is written when
+// the archive is closed, and only appears under its name once committed, so an
+// interrupted backup leaves no snapshot behind.
+type RepoArchive struct {
+	Archive
+	repo     *Repository
+	snapshot *RepoSnapshot
+	// Path of the snapshot manifest, and the file it's written to, which is
+	// nil during a dry run.
+	name    string
+	file    *AtomicFile
+	encoder *zstd.Encoder
+	log     *Logger
+	// Statistics reported on Close.
+	chunks, newChunks int
+	stored            int64
+}
+
+// Creates a new snapshot in the repository at dir, creating the repository if
+// needed. The level is that of zstd, which compresses the chunks. Messages go
+// to log.
+func NewRepoArchive(dir string, level int, log *Logger) (*RepoArchive, error) {
+	opts, err := zstdOptions(level)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := CreateRepository(log, dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id := now.UTC().Format("20060102T150405Z")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(repo.SnapshotPath(id)); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		id = now.UTC().Format("20060102T150405Z") + "-" + strconv.Itoa(n)
+	}
+	var fp *AtomicFile
+	if !options.DryRun {
+		if fp, err = CreateAtomic(repo.SnapshotPath(id)); err != nil {
+			return nil, err
+		}
+	}
+	return &RepoArchive{
+		repo: repo,
+		name: repo.SnapshotPath(id),
+		file: fp,
+		snapshot: &RepoSnapshot{
+			Format:  RepoSnapshotFormat,
+			ID:      id,
+			Time:    now,
+			Members: []RepoMember{},
+		},
+		encoder: encoder,
+		log:     log,
+	}, nil
+}
+
+// Returns the path of the snapshot manifest.
+func (r *RepoArchive) Name() string {
+	return r.name
+}
+
+func (r *RepoArchive) TempName() string {
+	if r.file == nil {
+		return r.name
+	}
+	return r.file.Name()
+}
+
+func (r *RepoArchive) Close() error {
+	r.encoder.Close()
+	if r.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(r.snapshot)
+	if err != nil {
+		return err
+	}
+	if _, err := r.file.Write(data); err != nil {
+		return err
+	}
+	r.log.Verbosef("%s: %d chunks, %d new, %d bytes stored", r.Name(), r.chunks, r.newChunks, r.stored)
+	return r.file.Close()
+}
+
+// Writes the snapshot manifest under its name. The chunks are already in the
+// repository.
+func (r *RepoArchive) Commit() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Commit()
+}
+
+// Discards the snapshot manifest. Any chunks stored for it are left for prune.
+func (r *RepoArchive) Abort() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Abort()
+}
+
+func (r *RepoArchive) Flush() error {
+	return nil
+}
+
+func (r *RepoArchive) AddFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return r.AddDir(d, stat, name)
+		}
+		fp, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		return r.AddFile(fp, stat, "", name)
+	})
+}
+
+// Returns a member describing the file, recording its link target and owner.
+func newRepoMember(stat fs.FileInfo, source, name string) (RepoMember, error) {
+	// The tar header has already worked out the details.
+	hdr, err := NewTarHeader(stat, source, name)
+	if err != nil {
+		return RepoMember{}, err
+	}
+	member := RepoMember{
+		Name:     hdr.Name,
+		Mode:     stat.Mode(),
+		ModTime:  stat.ModTime(),
+		Linkname: hdr.Linkname,
+	}
+	if stat.Sys() != nil {
+		member.Uid, member.Gid = &hdr.Uid, &hdr.Gid
+		member.Uname, member.Gname = hdr.Uname, hdr.Gname
+	}
+	return member, nil
+}
+
+func (r *RepoArchive) AddFile(fp io.Reader, stat fs.FileInfo, source, name string) error {
+	r.log.Debugf("AddFile(): stat.Name(): %q source: %q name: %q", stat.Name(), source, name)
+	member, err := newRepoMember(stat, source, name)
+	if err != nil {
+		return err
+	}
+	r.log.Verbosef("+ %s (%s)", member.Name, member.Linkname)
+	if stat.Mode().IsRegular() {
+		cfg := r.repo.Config
+		chunker := NewChunker(fp, cfg.ChunkMin, cfg.ChunkAvg, cfg.ChunkMax)
+		for {
+			chunk, err := chunker.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("%s: %w", FormatName(r, name), err)
+			}
+			id, stored, err := r.repo.PutChunk(chunk, r.encoder)
+			if err != nil {
+				return err
+			}
+			member.Chunks = append(member.Chunks, id)
+			member.Size += int64(len(chunk))
+			r.chunks++
+			if stored > 0 {
+				r.newChunks++
+				r.stored += stored
+			}
+		}
+	}
+	r.snapshot.Members = append(r.snapshot.Members, member)
+	return nil
+}
+
+func (r *RepoArchive) AddDir(dp fs.DirEntry, stat fs.FileInfo, name string) error {
+	r.log.Debugf("AddDir(): stat.Name(): %q name: %q", stat.Name(), name)
+	member, err := newRepoMember(stat, name, name)
+	if err != nil {
+		return err
+	}
+	r.log.Verbosef("+ %s", member.Name)
+	r.snapshot.Members = append(r.snapshot.Members, member)
+	return nil
+}
+
+// Reads a snapshot from a repository.
+type RepoArchiveReader struct {
+	name     string
+	repo     *Repository
+	snapshot *RepoSnapshot
+	decoder  *zstd.Decoder
+	// Index of the current member in snapshot.Members.
+	index int
+	// Index of the next chunk of the current member, and what remains of the
+	// last one read.
+	chunk int
+	buf   []byte
+}
+
+// Opens a snapshot for reading, given the path of its manifest, or of the
+// repository to read the latest snapshot.
+func OpenRepoArchive(name string) (*RepoArchiveReader, error) {
+	var repo *Repository
+	var snapshot *RepoSnapshot
+	var err error
+	if IsRepository(name) {
+		if repo, err = OpenRepository(name); err != nil {
+			return nil, err
+		}
+		snapshots, err := repo.Snapshots()
+		if err != nil {
+			return nil, err
+		} else if len(snapshots) == 0 {
+			return nil, fmt.Errorf("%s: no snapshots", name)
+		}
+		snapshot = snapshots[len(snapshots)-1]
+		name = repo.SnapshotPath(snapshot.ID)
+	} else {
+		// Manifests live in the snapshots directory of the repository.
+		if repo, err = OpenRepository(path.Dir(path.Dir(name))); err != nil {
+			return nil, err
+		}
+		if snapshot, err = ReadRepoSnapshot(name); err != nil {
+			return nil, err
+		}
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &RepoArchiveReader{
+		name:     name,
+		repo:     repo,
+		snapshot: snapshot,
+		decoder:  decoder,
+		index:    -1,
+	}, nil
+}
+
+func (r *RepoArchiveReader) Name() string {
+	return r.name
+}
+
+func (r *RepoArchiveReader) Close() error {
+	r.decoder.Close()
+	return nil
+}
+
+func (r *RepoArchiveReader) Next() (*ArchiveEntry, error) {
+	r.index++
+	r.chunk, r.buf = 0, nil
+	if r.index >= len(r.snapshot.Members) {
+		return nil, io.EOF
+	}
+	m := r.snapshot.Members[r.index]
+	entry := &ArchiveEntry{
+		Name:     m.Name,
+		Mode:     m.Mode,
+		Size:     m.Size,
+		ModTime:  m.ModTime,
+		Linkname: m.Linkname,
+		Uname:    m.Uname,
+		Gname:    m.Gname,
+	}
+	if m.Uid != nil && m.Gid != nil {
+		entry.Uid, entry.Gid, entry.HasOwner = *m.Uid, *m.Gid, true
+	}
+	return entry, nil
+}
+
+// Reads the contents of the current member, loading its chunks as needed. Each
+// chunk is checked against its SHA-256.
+func (r *RepoArchiveReader) Read(p []byte) (int, error) {
+	if r.index < 0 || r.index >= len(r.snapshot.Members) {
+		return 0, io.EOF
+	}
+	chunks := r.snapshot.Members[r.index].Chunks
+	for len(r.buf) == 0 {
+		if r.chunk >= len(chunks) {
+			return 0, io.EOF
+		}
+		data, err := r.repo.GetChunk(chunks[r.chunk], r.decoder)
+		if err != nil {
+			return 0, err
+		}
+		r.chunk++
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
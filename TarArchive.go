@@ -1,10 +1,11 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 
 package main
 
 import (
 	"archive/tar"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -13,18 +14,20 @@ import (
 
 type TarArchive struct {
 	Archive
-	file       *os.File
+	file       *AtomicFile
 	writer     *tar.Writer
 	compressor io.WriteCloser
+	log        *Logger
 }
 
 type FilterFunc func(io.Writer) io.WriteCloser
 
 // Creates a new tape archive (tar) at the specified path. If filter is not nil,
 // it will be called with the file handle to create a filter. This can be used
-// to create a compressed tape archive.
-func NewTarArchive(path string, filter FilterFunc) (*TarArchive, error) {
-	fp, err := os.Create(path)
+// to create a compressed tape archive. The archive is written to a temporary
+// file until committed, and messages go to log.
+func NewTarArchive(path string, filter FilterFunc, log *Logger) (*TarArchive, error) {
+	fp, err := CreateAtomic(path)
 	if err != nil {
 		return nil, err
 	}
@@ -43,10 +46,15 @@ func NewTarArchive(path string, filter FilterFunc) (*TarArchive, error) {
 		file:       fp,
 		writer:     writer,
 		compressor: compressor,
+		log:        log,
 	}, nil
 }
 
 func (t *TarArchive) Name() string {
+	return t.file.Path
+}
+
+func (t *TarArchive) TempName() string {
 	return t.file.Name()
 }
 
@@ -65,6 +73,14 @@ func (t *TarArchive) Close() error {
 	return nil
 }
 
+func (t *TarArchive) Commit() error {
+	return t.file.Commit()
+}
+
+func (t *TarArchive) Abort() error {
+	return t.file.Abort()
+}
+
 func (t *TarArchive) Flush() error {
 	return t.writer.Flush()
 }
@@ -74,17 +90,17 @@ func (t *TarArchive) AddFS(fsys fs.FS) error {
 }
 
 // Creates the best possible header from the stat info, and records the file as
-// `name` in the header.
-func NewTarHeader(stat fs.FileInfo, name string) (*tar.Header, error) {
+// `name` in the header. The `source` is the path of the file on disk.
+func NewTarHeader(stat fs.FileInfo, source, name string) (*tar.Header, error) {
 	var err error
 
 	// Since the Name() method on file/direntry/fileinfo structures typically
 	// return the base name (foo) rather than the real path (subdir/foo), we use
-	// that for attempting to read link info.
+	// the source path for attempting to read link info.
 
 	var linkName string
 	if stat.Mode().Type()&fs.ModeSymlink != 0 {
-		linkName, err = os.Readlink(name)
+		linkName, err = os.Readlink(source)
 		if err != nil {
 			Warningf("ReadLink: %v", err)
 		}
@@ -112,33 +128,105 @@ func NewTarHeader(stat fs.FileInfo, name string) (*tar.Header, error) {
 }
 
 func (t *TarArchive) writeHeader(hdr *tar.Header) error {
-	Verbosef("+ %s (%s)", hdr.Name, hdr.Linkname)
+	t.log.Verbosef("+ %s (%s)", hdr.Name, hdr.Linkname)
 	if err := t.writer.WriteHeader(hdr); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (t *TarArchive) AddFile(fp io.Reader, stat fs.FileInfo, name string) error {
-	Debugf("AddFile(): stat.Name(): %q name: %q", stat.Name(), name)
-	hdr, err := NewTarHeader(stat, name)
+func (t *TarArchive) AddFile(fp io.Reader, stat fs.FileInfo, source, name string) error {
+	t.log.Debugf("AddFile(): stat.Name(): %q source: %q name: %q", stat.Name(), source, name)
+	hdr, err := NewTarHeader(stat, source, name)
 	if err != nil {
 		return err
 	}
 	if err = t.writeHeader(hdr); err != nil {
+		return err
+	}
+	// Only regular files have contents. For a symbolic link, fp is whatever
+	// the link points to, if anything.
+	if hdr.Typeflag != tar.TypeReg {
 		return nil
 	}
 	return CopyData(t.writer, FormatName(t, name), fp, name)
 }
 
 func (t *TarArchive) AddDir(dp fs.DirEntry, stat fs.FileInfo, name string) error {
-	Debugf("AddDirEntry(): stat.Name(): %q name: %q", stat.Name(), name)
-	hdr, err := NewTarHeader(stat, name)
+	t.log.Debugf("AddDirEntry(): stat.Name(): %q name: %q", stat.Name(), name)
+	hdr, err := NewTarHeader(stat, name, name)
 	if err != nil {
 		return err
 	}
-	if err = t.writeHeader(hdr); err != nil {
-		return nil
+	return t.writeHeader(hdr)
+}
+
+// Reads a tape archive, optionally compressed.
+type TarArchiveReader struct {
+	file   *os.File
+	filter io.ReadCloser
+	reader *tar.Reader
+}
+
+// Opens the tape archive at path for reading. If unfilter is not nil, it is
+// called with the file handle to decompress it.
+func OpenTarArchive(path string, unfilter UnfilterFunc) (*TarArchiveReader, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	t := &TarArchiveReader{file: fp}
+	var r io.Reader = fp
+	if unfilter != nil {
+		t.filter, err = unfilter(fp)
+		if err != nil {
+			fp.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r = t.filter
+	}
+	t.reader = tar.NewReader(r)
+	return t, nil
+}
+
+func (t *TarArchiveReader) Name() string {
+	return t.file.Name()
+}
+
+func (t *TarArchiveReader) Close() error {
+	if t.filter != nil {
+		t.filter.Close()
+	}
+	return t.file.Close()
+}
+
+func (t *TarArchiveReader) Next() (*ArchiveEntry, error) {
+	hdr, err := t.reader.Next()
+	if err == io.EOF && t.filter != nil {
+		// The tar reader stops at the end of archive marker, which leaves the
+		// trailer of the compressed stream and its checks unread.
+		if _, derr := io.Copy(io.Discard, t.filter); derr != nil {
+			return nil, derr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveEntry{
+		Name:     hdr.Name,
+		Mode:     hdr.FileInfo().Mode(),
+		Size:     hdr.Size,
+		ModTime:  hdr.ModTime,
+		Linkname: hdr.Linkname,
+		HardLink: hdr.Typeflag == tar.TypeLink,
+		Uid:      hdr.Uid,
+		Gid:      hdr.Gid,
+		Uname:    hdr.Uname,
+		Gname:    hdr.Gname,
+		HasOwner: true,
+	}, nil
+}
+
+func (t *TarArchiveReader) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
 }
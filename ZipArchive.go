@@ -1,10 +1,11 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 
 package main
 
 import (
 	"archive/zip"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -13,13 +14,15 @@ import (
 
 type ZipArchive struct {
 	Archive
-	file   *os.File
+	file   *AtomicFile
 	writer *zip.Writer
+	log    *Logger
 }
 
-// Creates a new zip archive at the specified path.
-func NewZipArchive(path string) (*ZipArchive, error) {
-	fp, err := os.Create(path)
+// Creates a new zip archive at the specified path. The archive is written to a
+// temporary file until committed, and messages go to log.
+func NewZipArchive(path string, log *Logger) (*ZipArchive, error) {
+	fp, err := CreateAtomic(path)
 	if err != nil {
 		return nil, err
 	}
@@ -27,10 +30,15 @@ func NewZipArchive(path string) (*ZipArchive, error) {
 	return &ZipArchive{
 		file:   fp,
 		writer: zip.NewWriter(fp),
+		log:    log,
 	}, nil
 }
 
 func (z *ZipArchive) Name() string {
+	return z.file.Path
+}
+
+func (z *ZipArchive) TempName() string {
 	return z.file.Name()
 }
 
@@ -44,6 +52,14 @@ func (z *ZipArchive) Close() error {
 	return nil
 }
 
+func (z *ZipArchive) Commit() error {
+	return z.file.Commit()
+}
+
+func (z *ZipArchive) Abort() error {
+	return z.file.Abort()
+}
+
 func (z *ZipArchive) Flush() error {
 	return z.writer.Flush()
 }
@@ -55,15 +71,16 @@ func (z *ZipArchive) AddFS(fsys fs.FS) error {
 // Creates a suitable file header based on the stat information. Using
 // zip.Writer.Create() on the path instead of providing a real file header,
 // default constructs most field, which in turn leads to loss of info like the
-// timestamps.
-func NewZipHeader(stat fs.FileInfo, name string) (*zip.FileHeader, error) {
+// timestamps. The `source` is the path of the file on disk, and `name` the path
+// to record in the archive.
+func NewZipHeader(stat fs.FileInfo, source, name string) (*zip.FileHeader, error) {
 	// Info-Zip and a few others have a means of storing Unix symbolic links in
 	// the archive, but I'm not familiar with this extension, and Go's
 	// implementation doesn't seem to support it.
 	if stat.Mode().Type()&fs.ModeSymlink != 0 {
-		linkDestination, err := os.Readlink(name)
+		linkDestination, err := os.Readlink(source)
 		if err != nil {
-			Errorf("reading symlink %q failed: %v", name, err)
+			Errorf("reading symlink %q failed: %v", source, err)
 			linkDestination = ""
 		}
 		Warningf("Archive member %q refers to a symlink to %q and will be stored as that file's contents rather than as a symbolic link.",
@@ -78,12 +95,21 @@ func NewZipHeader(stat fs.FileInfo, name string) (*zip.FileHeader, error) {
 	// Ensure the name is built correctly. E.g., subdir/foo rather than foo.
 	hdr.Name = name
 	hdr.Method = zip.Deflate
+	if stat.Mode().Type()&fs.ModeSymlink != 0 {
+		// Record it as the regular file we're storing, otherwise extracting it
+		// would create a link to the contents.
+		mode := fs.FileMode(0644)
+		if target, err := os.Stat(source); err == nil {
+			mode = target.Mode().Perm()
+		}
+		hdr.SetMode(mode)
+	}
 	return hdr, nil
 }
 
-func (z *ZipArchive) AddFile(fp io.Reader, stat fs.FileInfo, name string) error {
-	Debugf("AddFile(): stat.Name(): %q name: %q", stat.Name(), name)
-	hdr, err := NewZipHeader(stat, name)
+func (z *ZipArchive) AddFile(fp io.Reader, stat fs.FileInfo, source, name string) error {
+	z.log.Debugf("AddFile(): stat.Name(): %q source: %q name: %q", stat.Name(), source, name)
+	hdr, err := NewZipHeader(stat, source, name)
 	if err != nil {
 		return err
 	}
@@ -95,12 +121,12 @@ func (z *ZipArchive) AddFile(fp io.Reader, stat fs.FileInfo, name string) error
 }
 
 func (z *ZipArchive) AddDir(dp fs.DirEntry, stat fs.FileInfo, name string) error {
-	Debugf("AddDirEntry(): stat.Name(): %q name: %q", stat.Name(), name)
+	z.log.Debugf("AddDirEntry(): stat.Name(): %q name: %q", stat.Name(), name)
 	path := name
 	if !strings.HasSuffix(path, "/") {
 		path += "/"
 	}
-	hdr, err := NewZipHeader(stat, path)
+	hdr, err := NewZipHeader(stat, name, path)
 	if err != nil {
 		return err
 	}
@@ -111,3 +137,69 @@ func (z *ZipArchive) AddDir(dp fs.DirEntry, stat fs.FileInfo, name string) error
 	}
 	return nil
 }
+
+// Reads a zip archive.
+type ZipArchiveReader struct {
+	name   string
+	reader *zip.ReadCloser
+	// Index of the current member in reader.File.
+	index int
+	// Contents of the current member, if opened.
+	contents io.ReadCloser
+}
+
+// Opens the zip archive at path for reading.
+func OpenZipArchive(path string) (*ZipArchiveReader, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &ZipArchiveReader{name: path, reader: r, index: -1}, nil
+}
+
+func (z *ZipArchiveReader) Name() string {
+	return z.name
+}
+
+func (z *ZipArchiveReader) Close() error {
+	z.closeContents()
+	return z.reader.Close()
+}
+
+func (z *ZipArchiveReader) closeContents() {
+	if z.contents != nil {
+		z.contents.Close()
+		z.contents = nil
+	}
+}
+
+func (z *ZipArchiveReader) Next() (*ArchiveEntry, error) {
+	z.closeContents()
+	z.index++
+	if z.index >= len(z.reader.File) {
+		return nil, io.EOF
+	}
+	f := z.reader.File[z.index]
+	return &ArchiveEntry{
+		Name:    f.Name,
+		Mode:    f.Mode(),
+		Size:    int64(f.UncompressedSize64),
+		ModTime: f.Modified,
+	}, nil
+}
+
+// Reads the contents of the current member. The CRC-32 is checked when the
+// end is reached.
+func (z *ZipArchiveReader) Read(p []byte) (int, error) {
+	if z.index < 0 || z.index >= len(z.reader.File) {
+		return 0, io.EOF
+	}
+	if z.contents == nil {
+		rc, err := z.reader.File[z.index].Open()
+		if err != nil {
+			return 0, err
+		}
+		z.contents = rc
+	}
+	return z.contents.Read(p)
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Suffix of the temporary files that archives are written to until complete.
+const PartialSuffix = ".partial"
+
+// A file written under a temporary name in the same directory, and renamed to
+// its real name once complete. A crash leaves at worst a partial file, rather
+// than a truncated file that looks valid by its name.
+type AtomicFile struct {
+	*os.File
+	// The name the file is renamed to by Commit.
+	Path   string
+	closed bool
+}
+
+// Returns the temporary name for a file named name, with random in place of
+// the unique part, or "*" for a glob pattern.
+func partialName(name, random string) string {
+	dir, base := filepath.Split(name)
+	return filepath.Join(dir, "."+base+"."+random+PartialSuffix)
+}
+
+// Returns the name of the file that partial is the temporary file of, the
+// reverse of partialName.
+func partialOf(partial string) string {
+	dir, base := filepath.Split(partial)
+	base = strings.TrimPrefix(strings.TrimSuffix(base, PartialSuffix), ".")
+	if i := strings.LastIndex(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	return filepath.Join(dir, base)
+}
+
+// Creates a temporary file to become the file named name on Commit.
+func CreateAtomic(name string) (*AtomicFile, error) {
+	for {
+		temp := partialName(name, fmt.Sprintf("%08x", rand.Uint32()))
+		fp, err := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return &AtomicFile{File: fp, Path: name}, nil
+	}
+}
+
+// Flushes the file to disk and closes it, keeping the temporary name.
+func (f *AtomicFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	err := f.File.Sync()
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Closes the file if needed, and renames it to its real name.
+func (f *AtomicFile) Commit() error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), f.Path); err != nil {
+		return err
+	}
+	// Make the rename itself durable. Not every platform can sync a
+	// directory, and the file is in place regardless, so that's not an error.
+	if dir, err := os.Open(filepath.Dir(f.Path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Closes and removes the temporary file, after a failure.
+func (f *AtomicFile) Abort() error {
+	if !f.closed {
+		f.closed = true
+		f.File.Close()
+	}
+	return os.Remove(f.Name())
+}
+
+// Removes the temporary files left behind by earlier runs that were writing
+// files matching the glob pattern, logging to log. If match isn't nil, the
+// files must match it as well, so that those of other specs matching the
+// pattern are left alone.
+func RemovePartials(log *Logger, pattern string, match *regexp.Regexp) error {
+	partials, err := filepath.Glob(partialName(pattern, "*"))
+	if err != nil {
+		return err
+	}
+	for _, partial := range partials {
+		if match != nil && !match.MatchString(partialOf(partial)) {
+			log.Debugf("RemovePartials(): %s isn't one of ours", partial)
+			continue
+		}
+		log.Warningf("Removing partial file %s left by an earlier run", partial)
+		if options.DryRun {
+			continue
+		}
+		if err := os.Remove(partial); err != nil {
+			return err
+		}
+	}
+	return nil
+}
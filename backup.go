@@ -0,0 +1,597 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2024-2026, Terry M. Poulin.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// State shared by the steps of running a backup specification.
+type BackupJob struct {
+	Spec    *BackupSpec
+	Archive Archive
+	Filter  *PathFilter
+	// Names added to the archive, when they'll be needed for verification.
+	Added map[string]bool
+	// Checksums of the files added, if the spec asks for them.
+	Manifest *Manifest
+	// Changes since the previous backup, for incremental backups.
+	Snapshot *Snapshot
+	// Glob pattern matching the archives of the spec, whatever the time, and
+	// the regular expression telling them apart from those of other specs
+	// that the pattern also matches.
+	PathGlob  string
+	PathMatch *regexp.Regexp
+	// Files left out under the skip-file policy.
+	Skipped []*FileError
+	// Where the job's messages go.
+	Log *Logger
+	// When the job started.
+	Started time.Time
+	// What's been added to the archive.
+	Stats BackupStats
+}
+
+// Counts of what a backup added to its archive. During a dry run, what it
+// would have added.
+type BackupStats struct {
+	Files    int
+	Dirs     int
+	Symlinks int
+	// Bytes of file contents read.
+	BytesRead int64
+}
+
+// A failure to read a file or directory to be archived, which the skip-file
+// policy skips over. Failures once a file's data is being written to the
+// archive can't be taken back, so they aren't FileErrors.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	// Errors from the os package already name the file.
+	var perr *fs.PathError
+	if errors.As(e.Err, &perr) {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Returns nil if err is a FileError that the spec's policy skips over, after
+// recording it. Otherwise returns err. Name is what the file would have been
+// archived as, which the snapshot keeps as it was, so that restoring doesn't
+// take the file for deleted.
+func (job *BackupJob) skipFailure(err error, name string) error {
+	var ferr *FileError
+	if job.Spec.OnError != OnErrorSkipFile || !errors.As(err, &ferr) {
+		return err
+	}
+	job.Log.Errorf("Skipping %v", ferr)
+	job.Skipped = append(job.Skipped, ferr)
+	job.Snapshot.Keep(name)
+	return nil
+}
+
+// Executes the backup specification using the provided context, logging to log.
+// ArchivePath is the spec's path with its template expanded for the time the
+// backup started. Returns the job, with any files skipped under the skip-file
+// policy, and nil once the job is complete, or an error if the operation
+// failed.
+func backup(ctx context.Context, spec BackupSpec, archivePath string, started time.Time, log *Logger) (*BackupJob, error) {
+	template := spec.Path
+	spec.Path = archivePath
+	job := &BackupJob{Spec: &spec, Log: log, Started: started}
+	switch spec.OnError {
+	case "", OnErrorAbort, OnErrorContinue, OnErrorSkipFile:
+	default:
+		return job, fmt.Errorf("invalid on_error: %s", spec.OnError)
+	}
+	for _, content := range spec.Contents {
+		if err := content.Validate(); err != nil {
+			return job, err
+		}
+	}
+	filter, err := NewPathFilter(spec.Include, spec.Exclude)
+	if err != nil {
+		return job, err
+	}
+	job.Filter = filter
+	// The patterns matching the spec's archives come from its template.
+	withTemplate := spec
+	withTemplate.Path = template
+	if job.PathGlob, err = withTemplate.PathGlob(); err != nil {
+		return job, fmt.Errorf("path: %w", err)
+	}
+	if job.PathMatch, err = withTemplate.PathRegexp(); err != nil {
+		return job, fmt.Errorf("path: %w", err)
+	}
+	log.Infof("Backing up to %s", spec.Path)
+	partials, match := job.PathGlob, job.PathMatch
+	if spec.Format == FormatRepo {
+		partials, match = path.Join(spec.Path, "snapshots", "*.json"), nil
+	}
+	if err := RemovePartials(log, partials, match); err != nil {
+		return job, err
+	}
+	if spec.Verify {
+		job.Added = make(map[string]bool)
+	}
+	if spec.Manifest != nil {
+		switch spec.Manifest.Location {
+		case "", ManifestSidecar, ManifestMember:
+		default:
+			return job, fmt.Errorf("invalid manifest location: %s", spec.Manifest.Location)
+		}
+		if job.Manifest, err = NewManifest(spec.Manifest.Algorithms); err != nil {
+			return job, err
+		}
+		job.Manifest.Log = log
+	}
+	switch mode := spec.SnapshotMode(); mode {
+	case "":
+	case ModeIncremental, ModeDifferential:
+		snapshot := withTemplate.SnapshotPath()
+		if snapshot == "" && mode == ModeDifferential {
+			return job, fmt.Errorf("%s mode needs a snapshot when the index would take a path template", mode)
+		} else if snapshot == "" {
+			return job, fmt.Errorf("%s mode needs a snapshot", mode)
+		}
+		if err := RemovePartials(log, snapshot, nil); err != nil {
+			return job, err
+		}
+		job.Snapshot, err = LoadSnapshot(log, snapshot, mode, spec.Full || options.Full, started)
+		if err != nil {
+			return job, err
+		}
+	default:
+		return job, fmt.Errorf("invalid mode: %s", mode)
+	}
+	if progress != nil && !options.DryRun {
+		job.scan()
+	}
+	archive, err := CreateArchive(spec.Path, spec.Format, &ArchiveOptions{
+		Level:   spec.Level,
+		Threads: spec.Threads,
+		Log:     log,
+	})
+	if err != nil {
+		return job, err
+	}
+	job.Archive = archive
+	err = job.archiveContents(ctx)
+	if err == nil && job.Manifest != nil && spec.Manifest.Location == ManifestMember && !options.DryRun {
+		name := path.Join(spec.Prefix, ManifestMemberName)
+		job.added(name)
+		err = job.Manifest.AddTo(archive, name)
+	}
+	if err == nil && job.Snapshot != nil {
+		err = job.addIncrementalInfo()
+	}
+	if cerr := archive.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && spec.Verify && !options.DryRun {
+		log.Verbosef("Verifying %s", archive.Name())
+		err = Verify(archive.TempName(), &VerifyOptions{
+			DisplayName: archive.Name(),
+			Expected:    job.Added,
+			Log:         log,
+		})
+	}
+	if err != nil || options.DryRun {
+		// Leave nothing behind that could be mistaken for a good archive.
+		if aerr := archive.Abort(); aerr != nil {
+			log.Warningf("Unable to remove %s: %v", archive.TempName(), aerr)
+		}
+		if err != nil {
+			return job, err
+		}
+		return job, job.applyRetention()
+	}
+	if err := archive.Commit(); err != nil {
+		archive.Abort()
+		return job, err
+	}
+	if job.Manifest != nil {
+		if spec.Manifest.Location != ManifestMember {
+			if err := job.Manifest.WriteSidecars(archive.Name()); err != nil {
+				return job, err
+			}
+		}
+		if err := job.Manifest.WriteArchiveDigests(archive.Name()); err != nil {
+			return job, err
+		}
+	}
+	if job.Snapshot != nil {
+		if err := job.Snapshot.Save(archive.Name()); err != nil {
+			return job, err
+		}
+	}
+	return job, job.applyRetention()
+}
+
+// Adds the IncrementalInfo member last, so restoring the archive replays the
+// deletions after everything else.
+func (job *BackupJob) addIncrementalInfo() error {
+	for _, name := range job.Snapshot.Deleted() {
+		job.Log.Detailf("Recording deletion of %s", name)
+	}
+	if options.DryRun {
+		return nil
+	}
+	name := path.Join(job.Spec.Prefix, IncrementalMemberName)
+	job.added(name)
+	return job.Snapshot.AddTo(job.Archive, name)
+}
+
+// Adds each of the spec's contents to the archive.
+func (job *BackupJob) archiveContents(ctx context.Context) error {
+	spec := job.Spec
+	job.Log.Verbosef("Archiving contents...")
+	for _, content := range spec.Contents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if content.Command != "" {
+			job.Log.Infof("Adding output of %s as %s", content.Command, content.As)
+			if err := job.backupCommand(ctx, content); err != nil {
+				return err
+			}
+			continue
+		}
+		fn := content.Path
+		stat, err := os.Stat(fn)
+		if err != nil {
+			if err := job.skipFailure(&FileError{fn, err}, spec.ArchiveName(content, fn)); err != nil {
+				return err
+			}
+			continue
+		}
+		job.Log.Verbosef("Inspecting %s (%s)", fn, fs.FormatFileInfo(stat))
+		if stat.IsDir() {
+			job.Log.Infof("Adding directory tree %s", fn)
+			err = job.backupDir(ctx, content)
+		} else if job.isExcluded(fn, false) || !job.Filter.Included(fn) {
+			continue
+		} else {
+			job.Log.Infof("Adding file %s", fn)
+			err = job.backupFile(ctx, stat, fn, spec.ArchiveName(content, fn), nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds the file at path to the archive as name. For incremental backups, it's
+// skipped if unchanged since the previous backup. The contents are those read
+// ahead, if not nil. Cancelling the context stops reading the file.
+func (job *BackupJob) backupFile(ctx context.Context, stat fs.FileInfo, path, name string, ahead *readAhead) error {
+	if job.Snapshot.Unchanged(name, stat) {
+		job.Log.Detailf("Unchanged %s", path)
+		return nil
+	}
+	if ahead != nil {
+		if err := ahead.wait(ctx); err != nil {
+			return err
+		}
+		if ahead.err != nil {
+			return job.skipFailure(&FileError{path, ahead.err}, name)
+		}
+		if ahead.contents != nil {
+			return job.addFileContents(ahead.contents, stat, path, name, ahead.manifestDigests, ahead.snapshotDigest)
+		}
+		// Changed size since, so read as usual.
+	}
+	var contents io.Reader
+	fp, err := os.Open(path)
+	if err == nil {
+		defer fp.Close()
+		contents = &contextReader{ctx, fp}
+	} else if stat.Mode().Type() == fs.ModeSymlink {
+		// Formats storing the link itself don't care what it points to, so a
+		// dangling link is still archived.
+		contents = strings.NewReader("")
+	} else {
+		return job.skipFailure(&FileError{path, err}, name)
+	}
+	if options.DryRun {
+		job.Snapshot.Record(name, stat, nil)
+		job.count(stat)
+		return nil
+	}
+	var manifestDigests []hash.Hash
+	var snapshotDigest hash.Hash
+	if stat.Mode().IsRegular() {
+		manifestDigests, snapshotDigest = job.newDigests()
+		contents = digesting(contents, manifestDigests, snapshotDigest)
+	}
+	return job.addFileContents(contents, stat, path, name, manifestDigests, snapshotDigest)
+}
+
+// Like addContents, for the contents of a file found by the scan for the
+// progress totals, which they count towards.
+func (job *BackupJob) addFileContents(contents io.Reader, stat fs.FileInfo, path, name string, manifestDigests []hash.Hash, snapshotDigest hash.Hash) error {
+	if progress != nil && stat.Mode().IsRegular() {
+		contents = progressReader{contents}
+	}
+	if err := job.addContents(contents, stat, path, name, manifestDigests, snapshotDigest); err != nil {
+		return err
+	}
+	progress.AddFile()
+	return nil
+}
+
+// Returns a reader computing the digests of what's read from r.
+func digesting(r io.Reader, manifestDigests []hash.Hash, snapshotDigest hash.Hash) io.Reader {
+	digests := manifestDigests
+	if snapshotDigest != nil {
+		digests = append(digests[:len(digests):len(digests)], snapshotDigest)
+	}
+	if len(digests) == 0 {
+		return r
+	}
+	return io.TeeReader(r, multiWriter(digests))
+}
+
+// Returns new digests for the manifest and the snapshot to compute of a file's
+// contents, either nil if not needed.
+func (job *BackupJob) newDigests() ([]hash.Hash, hash.Hash) {
+	var manifestDigests []hash.Hash
+	var snapshotDigest hash.Hash
+	if job.Manifest != nil {
+		manifestDigests = job.Manifest.NewDigests()
+	}
+	if job.Snapshot != nil {
+		snapshotDigest = sha256.New()
+	}
+	return manifestDigests, snapshotDigest
+}
+
+// Adds the contents of the file at path to the archive as name, recording it
+// with the digests, which are complete once the contents have been read.
+func (job *BackupJob) addContents(contents io.Reader, stat fs.FileInfo, path, name string, manifestDigests []hash.Hash, snapshotDigest hash.Hash) error {
+	job.added(name)
+	if err := job.Archive.AddFile(contents, stat, path, name); err != nil {
+		return err
+	}
+	job.count(stat)
+	if manifestDigests != nil {
+		job.Manifest.Add(name, manifestDigests)
+	}
+	job.Snapshot.Record(name, stat, snapshotDigest)
+	return nil
+}
+
+// Adds the directory entry to the archive as name.
+func (job *BackupJob) addDir(d fs.DirEntry, stat fs.FileInfo, name string) error {
+	job.added(name)
+	if err := job.Archive.AddDir(d, stat, name); err != nil {
+		return err
+	}
+	job.count(stat)
+	return nil
+}
+
+// Counts the file in the job's stats.
+func (job *BackupJob) count(stat fs.FileInfo) {
+	switch {
+	case stat.IsDir():
+		job.Stats.Dirs++
+	case stat.Mode().Type() == fs.ModeSymlink:
+		job.Stats.Symlinks++
+	default:
+		job.Stats.Files++
+		if stat.Mode().IsRegular() {
+			job.Stats.BytesRead += stat.Size()
+		}
+	}
+}
+
+// Reads from r until the context is cancelled, so that a large file doesn't
+// hold up cancellation.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// Records the name as added to the archive, if needed.
+func (job *BackupJob) added(name string) {
+	if job.Added != nil {
+		job.Added[name] = true
+	}
+}
+
+// Reports whether the path is excluded by the filter, logging the reason.
+func (job *BackupJob) isExcluded(path string, isDir bool) bool {
+	pattern := job.Filter.Excluded(path, isDir)
+	if pattern == "" {
+		return false
+	}
+	job.Log.Detailf("Excluding %s (matches %q)", path, pattern)
+	return true
+}
+
+// Logs a detail of what the backup does, such as a path being left out of the
+// archive. This is verbose output, except during a dry run where seeing what
+// would be done is the point.
+func logDetail(format string, args ...any) {
+	if options.DryRun {
+		Infof(format, args...)
+	} else {
+		Verbosef(format, args...)
+	}
+}
+
+// An entry found walking a directory tree, to be added to the archive.
+type walkEntry struct {
+	path string
+	name string
+	d    fs.DirEntry
+	stat fs.FileInfo
+	// Whether the filter includes the entry. Directories that it doesn't are
+	// only added once something inside them is.
+	included bool
+	// The contents of a regular file, if read ahead.
+	contents *readAhead
+	// A failure to read the entry, instead of any of the above but the path
+	// and name.
+	err *FileError
+}
+
+// Returns the entry to add to the archive for a path found walking the
+// content's directory tree, given the arguments of an fs.WalkDirFunc. Returns
+// a nil entry for paths that are left out, along with fs.SkipDir for a
+// directory. A failure to read the path is returned as an entry as well, so
+// it's handled in order.
+func (job *BackupJob) walkEntry(ctx context.Context, content Content, path string, d fs.DirEntry, err error) (*walkEntry, error) {
+	if err != nil {
+		// N.B. if err is set, d is nil.
+		job.Log.Debugf("walkDirFunc(%s, nil, %v)", path, err)
+		return &walkEntry{path: path, name: job.Spec.ArchiveName(content, path), err: &FileError{path, err}}, nil
+	}
+	job.Log.Debugf("walkDirFunc(%s, %s, %v)", path, fs.FormatDirEntry(d), err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if job.isExcluded(path, d.IsDir()) {
+		if d.IsDir() {
+			return nil, fs.SkipDir
+		}
+		return nil, nil
+	}
+	// Since it's valid on files and directories, we can stat before caring
+	// which it references.
+	stat, err := d.Info()
+	if err != nil {
+		return &walkEntry{path: path, name: job.Spec.ArchiveName(content, path), err: &FileError{path, fmt.Errorf("stat failed: %w", err)}}, nil
+	}
+	included := job.Filter.Included(path)
+	if !d.IsDir() && !included {
+		return nil, nil
+	}
+	return &walkEntry{
+		path:     path,
+		name:     job.Spec.ArchiveName(content, path),
+		d:        d,
+		stat:     stat,
+		included: included,
+	}, nil
+}
+
+// A directory whose entry is added to the archive only once something inside
+// of it is.
+type pendingDir struct {
+	path string
+	name string
+	d    fs.DirEntry
+	stat fs.FileInfo
+}
+
+// Adds the entries of a directory tree to the archive in the order they're
+// walked.
+type dirAdder struct {
+	job     *BackupJob
+	pending []pendingDir
+}
+
+// Drops the pending directories that aren't parents of path.
+func (a *dirAdder) trimPending(path string) {
+	for len(a.pending) > 0 {
+		parent := a.pending[len(a.pending)-1].path
+		if strings.HasPrefix(path, strings.TrimSuffix(parent, "/")+"/") {
+			break
+		}
+		a.pending = a.pending[:len(a.pending)-1]
+	}
+}
+
+// Adds the pending directories now that something inside them is.
+func (a *dirAdder) addPending() error {
+	for _, dir := range a.pending {
+		if err := a.job.addDir(dir.d, dir.stat, dir.name); err != nil {
+			return err
+		}
+	}
+	a.pending = a.pending[:0]
+	return nil
+}
+
+// Adds the entry to the archive, returning nil or an error to stop walking.
+func (a *dirAdder) add(ctx context.Context, entry *walkEntry) error {
+	job := a.job
+	if entry.err != nil {
+		// We can return nil or fs.SkipDir/fs.SkipAll to ignore this tree,
+		// or an error to bork the operation.
+		return job.skipFailure(entry.err, entry.name)
+	}
+	a.trimPending(entry.path)
+	if !entry.d.IsDir() {
+		if !options.DryRun {
+			if err := a.addPending(); err != nil {
+				return err
+			}
+		}
+		return job.backupFile(ctx, entry.stat, entry.path, entry.name, entry.contents)
+	}
+	job.Snapshot.Record(entry.name, entry.stat, nil)
+	if options.DryRun {
+		if entry.included {
+			job.count(entry.stat)
+		}
+		return nil
+	}
+	if !entry.included {
+		a.pending = append(a.pending, pendingDir{entry.path, entry.name, entry.d, entry.stat})
+		return nil
+	}
+	if err := a.addPending(); err != nil {
+		return err
+	}
+	return job.addDir(entry.d, entry.stat, entry.name)
+}
+
+// Recursively adds the content's directory tree to the archive, skipping
+// anything the filter or the spec's ignore files reject. When the filter has
+// include patterns, directories are only added if they contain something that
+// is included. Stops early if the context is cancelled.
+func (job *BackupJob) backupDir(ctx context.Context, content Content) error {
+	if job.Spec.Readers > 1 && !options.DryRun {
+		return job.backupDirReadingAhead(ctx, content)
+	}
+	adder := &dirAdder{job: job}
+	fn := func(path string, d fs.DirEntry, err error) error {
+		entry, err := job.walkEntry(ctx, content, path, d, err)
+		if entry == nil {
+			return err
+		}
+		return adder.add(ctx, entry)
+	}
+	return WalkDir(content.Path, job.Spec.IgnoreFiles, job.Log, fn)
+}
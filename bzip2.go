@@ -0,0 +1,567 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The standard library can only decompress bzip2, so this is the compression
+// side. It follows the structure of the reference implementation: each block
+// is run-length encoded, put through the Burrows-Wheeler transform, move-to-
+// front and zero-run encoded, then written with up to six Huffman tables.
+
+const (
+	bzip2BlockMagic  = 0x314159265359
+	bzip2StreamMagic = 0x177245385090
+	// Symbols are coded in groups of this many, each group selecting a table.
+	bzip2GroupSize = 50
+	// Longest code the encoder will produce. Decoders accept up to 20.
+	bzip2MaxCodeLen = 17
+	// Passes spent refining the Huffman tables for each block.
+	bzip2Iterations = 4
+	bzip2RunA       = 0
+	bzip2RunB       = 1
+)
+
+type Bzip2Writer struct {
+	bw *bitWriter
+	// Maximum size of the run-length encoded block.
+	blockSize int
+	// Run-length encoded data for the current block.
+	block []byte
+	// CRC of the raw data in the current block and of the whole stream.
+	blockCRC    uint32
+	combinedCRC uint32
+	// Pending run of runLen copies of runByte, not yet added to block.
+	runByte byte
+	runLen  int
+	closed  bool
+}
+
+// Creates a new bzip2 compressor writing to w. Level 1 through 9 selects the
+// block size in units of 100 kB, with 9 being the usual default.
+func NewBzip2Writer(w io.Writer, level int) (*Bzip2Writer, error) {
+	if level < 1 || level > 9 {
+		return nil, fmt.Errorf("invalid bzip2 compression level: %d", level)
+	}
+	z := &Bzip2Writer{
+		bw: newBitWriter(w),
+		// The reference encoder leaves the same headroom.
+		blockSize: level*100000 - 19,
+	}
+	z.block = make([]byte, 0, z.blockSize)
+	z.bw.WriteBits(8, 'B')
+	z.bw.WriteBits(8, 'Z')
+	z.bw.WriteBits(8, 'h')
+	z.bw.WriteBits(8, uint64('0'+level))
+	z.blockCRC = 0xffffffff
+	return z, nil
+}
+
+func (z *Bzip2Writer) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("bzip2: write to closed writer")
+	}
+	for _, b := range p {
+		if z.runLen > 0 && b == z.runByte && z.runLen < 255 {
+			z.runLen++
+			continue
+		}
+		z.flushRun()
+		z.runByte = b
+		z.runLen = 1
+	}
+	if z.bw.err != nil {
+		return 0, z.bw.err
+	}
+	return len(p), nil
+}
+
+// Writes the remaining data and the end of stream marker. This does not close
+// the underlying writer.
+func (z *Bzip2Writer) Close() error {
+	if z.closed {
+		return z.bw.err
+	}
+	z.closed = true
+	z.flushRun()
+	if len(z.block) > 0 {
+		z.writeBlock()
+	}
+	z.bw.WriteBits(48, bzip2StreamMagic)
+	z.bw.WriteBits(32, uint64(z.combinedCRC))
+	return z.bw.Flush()
+}
+
+// Adds the pending run to the block, starting a new block when it won't fit.
+// Runs of four or more are stored as four bytes followed by the extra count.
+func (z *Bzip2Writer) flushRun() {
+	if z.runLen == 0 {
+		return
+	}
+	if len(z.block)+5 > z.blockSize {
+		z.writeBlock()
+	}
+	for i := 0; i < z.runLen; i++ {
+		z.blockCRC = bzip2UpdateCRC(z.blockCRC, z.runByte)
+	}
+	if z.runLen < 4 {
+		for i := 0; i < z.runLen; i++ {
+			z.block = append(z.block, z.runByte)
+		}
+	} else {
+		z.block = append(z.block, z.runByte, z.runByte, z.runByte, z.runByte, byte(z.runLen-4))
+	}
+	z.runLen = 0
+}
+
+// Compresses and writes the current block, then resets it.
+func (z *Bzip2Writer) writeBlock() {
+	crc := ^z.blockCRC
+	z.combinedCRC = (z.combinedCRC<<1 | z.combinedCRC>>31) ^ crc
+
+	bwt, origPtr := bwtransform(z.block)
+
+	// Map the bytes in use onto a dense alphabet.
+	var inUse [256]bool
+	for _, b := range z.block {
+		inUse[b] = true
+	}
+	var unseqToSeq [256]byte
+	nInUse := 0
+	for i := range inUse {
+		if inUse[i] {
+			unseqToSeq[i] = byte(nInUse)
+			nInUse++
+		}
+	}
+	alphaSize := nInUse + 2
+	symbols := bzip2MTF(bwt, &unseqToSeq, nInUse)
+
+	z.bw.WriteBits(48, bzip2BlockMagic)
+	z.bw.WriteBits(32, uint64(crc))
+	z.bw.WriteBits(1, 0) // Not randomized.
+	z.bw.WriteBits(24, uint64(origPtr))
+
+	var rangesInUse uint16
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				rangesInUse |= 1 << (15 - i)
+				break
+			}
+		}
+	}
+	z.bw.WriteBits(16, uint64(rangesInUse))
+	for i := 0; i < 16; i++ {
+		if rangesInUse&(1<<(15-i)) == 0 {
+			continue
+		}
+		var bits uint16
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				bits |= 1 << (15 - j)
+			}
+		}
+		z.bw.WriteBits(16, uint64(bits))
+	}
+
+	lengths, selectors := bzip2BuildTables(symbols, alphaSize)
+	z.bw.WriteBits(3, uint64(len(lengths)))
+	z.bw.WriteBits(15, uint64(len(selectors)))
+	// Selectors are move-to-front coded and written in unary.
+	mtf := make([]byte, len(lengths))
+	for i := range mtf {
+		mtf[i] = byte(i)
+	}
+	for _, sel := range selectors {
+		j := 0
+		for mtf[j] != sel {
+			j++
+		}
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = sel
+		for ; j > 0; j-- {
+			z.bw.WriteBits(1, 1)
+		}
+		z.bw.WriteBits(1, 0)
+	}
+	// Code lengths are delta coded from the previous symbol's length.
+	codes := make([][]uint32, len(lengths))
+	for t, table := range lengths {
+		cur := int(table[0])
+		z.bw.WriteBits(5, uint64(cur))
+		for _, l := range table {
+			for ; cur < int(l); cur++ {
+				z.bw.WriteBits(2, 2)
+			}
+			for ; cur > int(l); cur-- {
+				z.bw.WriteBits(2, 3)
+			}
+			z.bw.WriteBits(1, 0)
+		}
+		codes[t] = bzip2AssignCodes(table)
+	}
+	for g, sel := range selectors {
+		start := g * bzip2GroupSize
+		end := min(start+bzip2GroupSize, len(symbols))
+		for _, sym := range symbols[start:end] {
+			z.bw.WriteBits(uint(lengths[sel][sym]), uint64(codes[sel][sym]))
+		}
+	}
+
+	z.block = z.block[:0]
+	z.blockCRC = 0xffffffff
+}
+
+// Returns the Burrows-Wheeler transform of data and the position of the
+// original string amongst its sorted rotations. This sorts the cyclic
+// rotations by prefix doubling with counting sorts, O(n log n).
+func bwtransform(data []byte) ([]byte, int) {
+	n := len(data)
+	p := make([]int32, n)  // Rotations in sorted order.
+	c := make([]int32, n)  // Equivalence class of each rotation.
+	pn := make([]int32, n) // Scratch for p.
+	cn := make([]int32, n) // Scratch for c.
+	cnt := make([]int32, max(n, 256))
+
+	for _, b := range data {
+		cnt[b]++
+	}
+	for i := 1; i < 256; i++ {
+		cnt[i] += cnt[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		cnt[data[i]]--
+		p[cnt[data[i]]] = int32(i)
+	}
+	classes := int32(1)
+	c[p[0]] = 0
+	for i := 1; i < n; i++ {
+		if data[p[i]] != data[p[i-1]] {
+			classes++
+		}
+		c[p[i]] = classes - 1
+	}
+	for h := 1; h < n && int(classes) < n; h <<= 1 {
+		// Sort by the second half first, which is the already sorted order
+		// shifted back by h, then stable sort by the first half's class.
+		for i := 0; i < n; i++ {
+			pn[i] = p[i] - int32(h)
+			if pn[i] < 0 {
+				pn[i] += int32(n)
+			}
+		}
+		clear(cnt[:classes])
+		for i := 0; i < n; i++ {
+			cnt[c[pn[i]]]++
+		}
+		for i := int32(1); i < classes; i++ {
+			cnt[i] += cnt[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			cnt[c[pn[i]]]--
+			p[cnt[c[pn[i]]]] = pn[i]
+		}
+		cn[p[0]] = 0
+		classes = 1
+		for i := 1; i < n; i++ {
+			cur0, prev0 := c[p[i]], c[p[i-1]]
+			cur1, prev1 := c[(int(p[i])+h)%n], c[(int(p[i-1])+h)%n]
+			if cur0 != prev0 || cur1 != prev1 {
+				classes++
+			}
+			cn[p[i]] = classes - 1
+		}
+		c, cn = cn, c
+	}
+
+	out := make([]byte, n)
+	origPtr := 0
+	for i, start := range p {
+		if start == 0 {
+			origPtr = i
+			out[i] = data[n-1]
+		} else {
+			out[i] = data[start-1]
+		}
+	}
+	return out, origPtr
+}
+
+// Performs move-to-front coding of data, with runs of zeros written in
+// bijective base two using RUNA and RUNB, and terminated by the end of block
+// symbol. Other values are shifted up by one to make room for RUNB.
+func bzip2MTF(data []byte, unseqToSeq *[256]byte, nInUse int) []uint16 {
+	eob := uint16(nInUse + 1)
+	symbols := make([]uint16, 0, len(data)+1)
+	var order [256]byte
+	for i := range order {
+		order[i] = byte(i)
+	}
+	zeros := 0
+	flushZeros := func() {
+		if zeros == 0 {
+			return
+		}
+		zeros--
+		for {
+			if zeros&1 != 0 {
+				symbols = append(symbols, bzip2RunB)
+			} else {
+				symbols = append(symbols, bzip2RunA)
+			}
+			if zeros < 2 {
+				break
+			}
+			zeros = (zeros - 2) / 2
+		}
+		zeros = 0
+	}
+	for _, b := range data {
+		seq := unseqToSeq[b]
+		if order[0] == seq {
+			zeros++
+			continue
+		}
+		flushZeros()
+		j := 1
+		for order[j] != seq {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = seq
+		symbols = append(symbols, uint16(j+1))
+	}
+	flushZeros()
+	return append(symbols, eob)
+}
+
+// Chooses the Huffman tables for a block, returning the code lengths of each
+// table and which table codes each group of symbols. Like the reference
+// encoder, the tables start out covering bands of similar total frequency and
+// are then refined by assigning each group to its cheapest table.
+func bzip2BuildTables(symbols []uint16, alphaSize int) ([][]uint8, []byte) {
+	var nTables int
+	switch n := len(symbols); {
+	case n < 200:
+		nTables = 2
+	case n < 600:
+		nTables = 3
+	case n < 1200:
+		nTables = 4
+	case n < 2400:
+		nTables = 5
+	default:
+		nTables = 6
+	}
+	nGroups := (len(symbols) + bzip2GroupSize - 1) / bzip2GroupSize
+
+	freq := make([]int, alphaSize)
+	for _, sym := range symbols {
+		freq[sym]++
+	}
+	lengths := make([][]uint8, nTables)
+	remaining := len(symbols)
+	lo := 0
+	for t := nTables; t > 0; t-- {
+		target := remaining / t
+		hi := lo - 1
+		acc := 0
+		for acc < target && hi < alphaSize-1 {
+			hi++
+			acc += freq[hi]
+		}
+		if hi > lo && t != nTables && t != 1 && (nTables-t)%2 == 1 {
+			acc -= freq[hi]
+			hi--
+		}
+		table := make([]uint8, alphaSize)
+		for i := range table {
+			if i < lo || i > hi {
+				table[i] = 15
+			}
+		}
+		lengths[nTables-t] = table
+		lo = hi + 1
+		remaining -= acc
+	}
+
+	selectors := make([]byte, nGroups)
+	for iter := 0; iter < bzip2Iterations; iter++ {
+		freqs := make([][]int, nTables)
+		for t := range freqs {
+			freqs[t] = make([]int, alphaSize)
+		}
+		for g := range selectors {
+			start := g * bzip2GroupSize
+			end := min(start+bzip2GroupSize, len(symbols))
+			best, bestCost := 0, -1
+			for t, table := range lengths {
+				cost := 0
+				for _, sym := range symbols[start:end] {
+					cost += int(table[sym])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[g] = byte(best)
+			for _, sym := range symbols[start:end] {
+				freqs[best][sym]++
+			}
+		}
+		for t := range lengths {
+			lengths[t] = huffmanLengths(freqs[t], bzip2MaxCodeLen)
+		}
+	}
+	return lengths, selectors
+}
+
+// Computes Huffman code lengths for the given symbol frequencies, limited to
+// maxLen bits. Every symbol gets a code, even if its frequency is zero, as the
+// format requires a length for each symbol in the alphabet.
+func huffmanLengths(freq []int, maxLen int) []uint8 {
+	weights := make([]int, len(freq))
+	for i, f := range freq {
+		weights[i] = max(f, 1)
+	}
+	lengths := make([]uint8, len(freq))
+	for {
+		type node struct {
+			weight int
+			depth  int
+			// Symbols beneath this node.
+			leaves []int
+		}
+		nodes := make([]node, len(weights))
+		for i, w := range weights {
+			nodes[i] = node{weight: w, leaves: []int{i}}
+		}
+		clear(lengths)
+		for len(nodes) > 1 {
+			sort.SliceStable(nodes, func(i, j int) bool {
+				if nodes[i].weight != nodes[j].weight {
+					return nodes[i].weight < nodes[j].weight
+				}
+				return nodes[i].depth < nodes[j].depth
+			})
+			a, b := nodes[0], nodes[1]
+			for _, leaf := range a.leaves {
+				lengths[leaf]++
+			}
+			for _, leaf := range b.leaves {
+				lengths[leaf]++
+			}
+			merged := node{
+				weight: a.weight + b.weight,
+				depth:  max(a.depth, b.depth) + 1,
+				leaves: append(a.leaves, b.leaves...),
+			}
+			nodes = append([]node{merged}, nodes[2:]...)
+		}
+		tooLong := false
+		for _, l := range lengths {
+			if int(l) > maxLen {
+				tooLong = true
+				break
+			}
+		}
+		if !tooLong {
+			return lengths
+		}
+		// Flatten the distribution and try again, like the reference encoder.
+		for i := range weights {
+			weights[i] = 1 + weights[i]/2
+		}
+	}
+}
+
+// Assigns canonical codes for the given lengths, in the order the decoder
+// expects: by increasing length, then by symbol.
+func bzip2AssignCodes(lengths []uint8) []uint32 {
+	codes := make([]uint32, len(lengths))
+	minLen, maxLen := uint8(32), uint8(0)
+	for _, l := range lengths {
+		minLen = min(minLen, l)
+		maxLen = max(maxLen, l)
+	}
+	var code uint32
+	for n := minLen; n <= maxLen; n++ {
+		for i, l := range lengths {
+			if l == n {
+				codes[i] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+var bzip2CRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}()
+
+// Updates the big endian CRC-32 used by bzip2 with b.
+func bzip2UpdateCRC(crc uint32, b byte) uint32 {
+	return crc<<8 ^ bzip2CRCTable[byte(crc>>24)^b]
+}
+
+// Writes bits most significant first, as bzip2 expects.
+type bitWriter struct {
+	w     io.Writer
+	buf   []byte
+	bits  uint64
+	nbits uint
+	err   error
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{w: w, buf: make([]byte, 0, 4096)}
+}
+
+// Writes the low n bits of v, where n is at most 48.
+func (bw *bitWriter) WriteBits(n uint, v uint64) {
+	bw.bits = bw.bits<<n | v&(1<<n-1)
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.nbits -= 8
+		bw.buf = append(bw.buf, byte(bw.bits>>bw.nbits))
+	}
+	if len(bw.buf) == cap(bw.buf) {
+		bw.flushBuffer()
+	}
+}
+
+func (bw *bitWriter) flushBuffer() {
+	if bw.err == nil && len(bw.buf) > 0 {
+		_, bw.err = bw.w.Write(bw.buf)
+	}
+	bw.buf = bw.buf[:0]
+}
+
+// Pads the final byte with zeros and writes out anything buffered.
+func (bw *bitWriter) Flush() error {
+	if bw.nbits > 0 {
+		bw.WriteBits(8-bw.nbits, 0)
+	}
+	bw.flushBuffer()
+	return bw.err
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// Compresses data with the given level, writing it in pieces of at most
+// chunk bytes, and checks that compress/bzip2 reads it back.
+func testBzip2RoundTrip(t *testing.T, name string, data []byte, level, chunk int) {
+	t.Helper()
+	var buf bytes.Buffer
+	z, err := NewBzip2Writer(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rest := data; len(rest) > 0; {
+		n := min(chunk, len(rest))
+		if _, err := z.Write(rest[:n]); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		rest = rest[n:]
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	got, err := io.ReadAll(bzip2.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("%s: read back %d bytes different from the %d written", name, len(got), len(data))
+	}
+}
+
+func TestBzip2RoundTrip(t *testing.T) {
+	random := make([]byte, 300000)
+	rand.New(rand.NewSource(1)).Read(random)
+	// Text-like data compresses well, so it takes a lot to fill a block.
+	var text bytes.Buffer
+	words := []string{"zephyr", "backup", "archive", "the", "of", "tar", "\n"}
+	rng := rand.New(rand.NewSource(2))
+	for text.Len() < 250000 {
+		text.WriteString(words[rng.Intn(len(words))])
+		text.WriteByte(' ')
+	}
+	// Runs of every length around the run-length encoding's limits.
+	var runs bytes.Buffer
+	for n := 1; n < 300; n++ {
+		runs.Write(bytes.Repeat([]byte{byte(n)}, n))
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		level int
+	}{
+		{"empty", nil, 9},
+		{"one byte", []byte{'x'}, 9},
+		{"two bytes", []byte{'x', 'y'}, 9},
+		{"all byte values", func() []byte {
+			b := make([]byte, 256)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			return b
+		}(), 9},
+		{"long run", bytes.Repeat([]byte{'a'}, 1000000), 1},
+		{"runs", runs.Bytes(), 9},
+		{"random", random, 9},
+		{"random, multiple blocks", random, 1},
+		{"text, multiple blocks", text.Bytes(), 1},
+	}
+	for _, test := range tests {
+		testBzip2RoundTrip(t, test.name, test.data, test.level, len(test.data)+1)
+		// Runs split across writes must be handled the same.
+		testBzip2RoundTrip(t, test.name+" in pieces", test.data, test.level, 251)
+	}
+}
+
+func TestBzip2Level(t *testing.T) {
+	for _, level := range []int{-1, 0, 10} {
+		if _, err := NewBzip2Writer(io.Discard, level); err == nil {
+			t.Errorf("NewBzip2Writer() accepted level %d", level)
+		}
+	}
+}
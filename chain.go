@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Layouts accepted for timestamps, tried in order. Those without a zone are in
+// local time.
+var TimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Parses a timestamp in one of the TimestampLayouts.
+func ParseTimestamp(s string) (time.Time, error) {
+	for _, layout := range TimestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %q", s)
+}
+
+// Returns the archives of a backup chain found at name, which is either a
+// directory of archives or a catalog, meaning a snapshot state file or the
+// index of a full backup.
+func LoadCatalog(name string) ([]SnapshotArchive, error) {
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return scanArchives(name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var state SnapshotState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: not a catalog: %w", name, err)
+	}
+	return state.Chain, nil
+}
+
+// Returns the archives in dir that were written by incremental or differential
+// backups. Other files are ignored, as are the temporary files of unfinished
+// backups and archives that can't be read, which are logged. Since the
+// IncrementalInfo member is added last, finding it takes reading through each
+// archive, decompressing it in full.
+func scanArchives(dir string) ([]SnapshotArchive, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var archives []SnapshotArchive
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), PartialSuffix) {
+			continue
+		}
+		name := path.Join(dir, entry.Name())
+		if _, err := DetectFormat(name); err != nil {
+			Debugf("scanArchives(): skipping %s: %v", name, err)
+			continue
+		}
+		info, err := ReadIncrementalInfo(name)
+		if err != nil {
+			Warningf("Skipping %v", err)
+			continue
+		} else if info == nil {
+			Verbosef("Skipping %s: not part of a backup chain", name)
+			continue
+		}
+		archives = append(archives, SnapshotArchive{
+			Path:  name,
+			Level: info.Level,
+			Time:  info.Time,
+			Base:  info.Base,
+		})
+	}
+	return archives, nil
+}
+
+// Returns the IncrementalInfo member of the archive at the path name, or nil
+// if it doesn't have one.
+func ReadIncrementalInfo(name string) (*IncrementalInfo, error) {
+	ar, err := OpenArchive(name)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+	for {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if !IsIncrementalMember(entry.Name) || !entry.Mode.IsRegular() {
+			continue
+		}
+		var info IncrementalInfo
+		if err := json.NewDecoder(ar).Decode(&info); err != nil {
+			return nil, fmt.Errorf("%s:%s: %w", name, entry.Name, err)
+		}
+		return &info, nil
+	}
+}
+
+// Returns the fewest archives that need to be restored, in order, to recreate
+// the state as of the given time. That's the last backup made at or before
+// then, preceded by the backups it builds upon back to a full backup.
+func ResolveChain(archives []SnapshotArchive, asOf time.Time) ([]SnapshotArchive, error) {
+	sorted := append([]SnapshotArchive(nil), archives...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+	last := -1
+	for i, archive := range sorted {
+		if !archive.Time.After(asOf) {
+			last = i
+		}
+	}
+	if last < 0 {
+		return nil, fmt.Errorf("no backup as of %v", asOf)
+	}
+	chain := []SnapshotArchive{sorted[last]}
+	for chain[0].Base != nil {
+		base := *chain[0].Base
+		i := sort.Search(last, func(i int) bool {
+			return !sorted[i].Time.Before(base)
+		})
+		if i >= last || !sorted[i].Time.Equal(base) {
+			return nil, fmt.Errorf("%s builds upon a backup of %v, which is missing", chain[0].Path, base)
+		}
+		chain = append([]SnapshotArchive{sorted[i]}, chain...)
+		last = i
+	}
+	return chain, nil
+}
+
+// Restores the chain of archives found at source, as for LoadCatalog, to
+// recreate the state as of the given time in ropts.Dest. The archives are
+// restored in order, replaying the deletions they record.
+func RestoreAsOf(source string, asOf time.Time, ropts *RestoreOptions) error {
+	archives, err := LoadCatalog(source)
+	if err != nil {
+		return err
+	}
+	chain, err := ResolveChain(archives, asOf)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	for _, archive := range chain {
+		logDetail("Restoring %s (level %d of %v)", archive.Path, archive.Level, archive.Time)
+	}
+	r := newRestorer(ropts)
+	for _, archive := range chain {
+		ar, err := OpenArchive(archive.Path)
+		if err != nil {
+			return err
+		}
+		err = r.restoreArchive(ar)
+		ar.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return r.finish()
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestResolveChain(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2026, 1, n, 0, 0, 0, 0, time.UTC)
+	}
+	base := func(n int) *time.Time {
+		t := day(n)
+		return &t
+	}
+	// Two full backups, each followed by incrementals, and a differential
+	// building upon the second one. Out of order, as when scanned.
+	archives := []SnapshotArchive{
+		{Path: "incr3", Level: 1, Time: day(3), Base: base(2)},
+		{Path: "full1", Level: 0, Time: day(1)},
+		{Path: "full2", Level: 0, Time: day(2)},
+		{Path: "incr4", Level: 2, Time: day(4), Base: base(3)},
+		{Path: "diff5", Level: 1, Time: day(5), Base: base(2)},
+	}
+	tests := []struct {
+		asOf time.Time
+		want []string
+	}{
+		{day(1), []string{"full1"}},
+		{day(1).Add(time.Hour), []string{"full1"}},
+		{day(2), []string{"full2"}},
+		{day(3), []string{"full2", "incr3"}},
+		{day(4), []string{"full2", "incr3", "incr4"}},
+		{day(5), []string{"full2", "diff5"}},
+		{day(9), []string{"full2", "diff5"}},
+	}
+	for _, test := range tests {
+		chain, err := ResolveChain(archives, test.asOf)
+		if err != nil {
+			t.Errorf("ResolveChain(%v): %v", test.asOf, err)
+			continue
+		}
+		var got []string
+		for _, archive := range chain {
+			got = append(got, archive.Path)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("ResolveChain(%v) = %v, want %v", test.asOf, got, test.want)
+		}
+	}
+
+	if chain, err := ResolveChain(archives, day(1).Add(-time.Hour)); err == nil {
+		t.Errorf("ResolveChain() before the first backup = %v, want an error", chain)
+	}
+	missing := []SnapshotArchive{archives[0], archives[3]}
+	if chain, err := ResolveChain(missing, day(4)); err == nil {
+		t.Errorf("ResolveChain() without the full backup = %v, want an error", chain)
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// Random values for each byte, mixed into the rolling hash. They must never
+// change, or the chunk boundaries of existing repositories would move and
+// nothing would deduplicate against them.
+var gearTable = func() (table [256]uint64) {
+	// SplitMix64 with a fixed seed.
+	state := uint64(0x7a657068797221)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Splits a stream into content-defined chunks, using a gear hash over the last
+// 64 bytes to find the boundaries. Since a boundary only depends on the bytes
+// right before it, inserting or removing data only changes the chunks around
+// the change, and the rest of the stream still splits into the same chunks.
+type Chunker struct {
+	reader *bufio.Reader
+	buf    []byte
+	// Bounds on the size of the chunks.
+	min, max int
+	// A boundary is where the hash has these bits clear.
+	mask uint64
+}
+
+// Returns a Chunker splitting r into chunks of min to max bytes. Past min, a
+// boundary is found every avg bytes on average, which must be a power of two.
+func NewChunker(r io.Reader, min, avg, max int) *Chunker {
+	// Use the high bits of the hash, which depend on more of the window.
+	shift := 64 - bits.Len(uint(avg-1))
+	return &Chunker{
+		reader: bufio.NewReaderSize(r, 256<<10),
+		buf:    make([]byte, 0, max),
+		min:    min,
+		max:    max,
+		mask:   uint64(avg-1) << shift,
+	}
+}
+
+// Returns the next chunk, or io.EOF at the end of the stream. The chunk is only
+// valid until the next call.
+func (c *Chunker) Next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var hash uint64
+	for len(c.buf) < c.max {
+		b, err := c.reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		hash = (hash << 1) + gearTable[b]
+		if len(c.buf) >= c.min && hash&c.mask == 0 {
+			break
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	return c.buf, nil
+}
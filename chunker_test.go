@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// Returns the chunks of data, as split with small bounds.
+func testChunks(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	const min, avg, max = 64, 256, 1024
+	var chunks [][]byte
+	c := NewChunker(bytes.NewReader(data), min, avg, max)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > max || len(chunk) < min && i != len(chunks)-1 {
+			t.Errorf("chunk %d of %d is %d bytes", i, len(chunks), len(chunk))
+		}
+	}
+	if joined := bytes.Join(chunks, nil); !bytes.Equal(joined, data) {
+		t.Errorf("chunks of %d bytes joined into %d different bytes", len(data), len(joined))
+	}
+	return chunks
+}
+
+func TestChunker(t *testing.T) {
+	if chunks := testChunks(t, nil); len(chunks) != 0 {
+		t.Errorf("empty input split into %d chunks", len(chunks))
+	}
+	if chunks := testChunks(t, []byte("x")); len(chunks) != 1 {
+		t.Errorf("one byte split into %d chunks", len(chunks))
+	}
+	// Without any boundaries, every chunk is as long as allowed.
+	testChunks(t, make([]byte, 10000))
+
+	data := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	before := testChunks(t, data)
+	// Inserting data only changes the chunks around it.
+	edited := append(append(append([]byte(nil), data[:1000]...), "inserted"...), data[1000:]...)
+	after := testChunks(t, edited)
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, chunk := range before {
+		seen[sha256.Sum256(chunk)] = true
+	}
+	shared := 0
+	for _, chunk := range after {
+		if seen[sha256.Sum256(chunk)] {
+			shared++
+		}
+	}
+	if shared < len(before)-3 {
+		t.Errorf("only %d of %d chunks unchanged by an insertion", shared, len(before))
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Adds the standard output of the content's command to the archive, as a
+// regular file named by the content's as. The tar formats need the size of a
+// file before its contents, so the output is spooled to a temporary file next
+// to the archive first. So is that of the other formats under the skip-file
+// policy, so that the command failing is a FileError like any other unreadable
+// file. Otherwise, the output is archived as it's written, and the command
+// failing fails the backup as the policy would anyway. What the command writes
+// to standard error is logged. Nothing is run during a dry run.
+func (job *BackupJob) backupCommand(ctx context.Context, content Content) error {
+	name := job.Spec.ArchiveName(content, content.As)
+	stat := &SyntheticFileInfo{
+		FileName:    name,
+		FileMode:    0644,
+		FileModTime: time.Now(),
+	}
+	if options.DryRun {
+		job.count(stat)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := shellCommand(ctx, content.Command)
+	cmd.WaitDelay = hookWaitDelay
+	stderr := &lineLogger{log: job.Log, prefix: content.As + ": "}
+	defer stderr.Flush()
+	cmd.Stderr = stderr
+	if _, ok := job.Archive.(*TarArchive); ok || job.Spec.OnError == OnErrorSkipFile {
+		return job.backupSpooledCommand(ctx, cmd, content, stat)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("command %q: %w", content.Command, err)
+	}
+	manifestDigests, snapshotDigest := job.newDigests()
+	// The size is unknown until the command is done, which the formats that
+	// don't need it up front find out for themselves.
+	output := &countingReader{stdout, &stat.FileSize}
+	contents := digesting(&contextReader{ctx, output}, manifestDigests, snapshotDigest)
+	err = job.addContents(contents, stat, "", name, manifestDigests, snapshotDigest)
+	if err != nil {
+		// Stop the command rather than wait on it to finish writing.
+		cancel()
+	}
+	if werr := cmd.Wait(); err == nil && ctx.Err() != nil {
+		// Killed because the backup was cancelled.
+		err = ctx.Err()
+	} else if err == nil && werr != nil {
+		err = fmt.Errorf("command %q: %w", content.Command, werr)
+	}
+	return err
+}
+
+// Runs the command with its output going to a temporary file, then adds that
+// to the archive as the output of the content's command. The file is named
+// like the archive's own temporary file, so one left by a crash is removed
+// along with it.
+func (job *BackupJob) backupSpooledCommand(ctx context.Context, cmd *exec.Cmd, content Content, stat *SyntheticFileInfo) error {
+	archive := job.Archive.Name()
+	spool, err := os.CreateTemp(filepath.Dir(archive), "."+filepath.Base(archive)+".*"+PartialSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	job.Log.Debugf("Spooling output of %s to %s", content.Command, spool.Name())
+	cmd.Stdout = spool
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return job.skipFailure(&FileError{content.Command, err}, stat.FileName)
+	}
+	if stat.FileSize, err = spool.Seek(0, io.SeekCurrent); err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	manifestDigests, snapshotDigest := job.newDigests()
+	contents := digesting(&contextReader{ctx, io.LimitReader(spool, stat.FileSize)}, manifestDigests, snapshotDigest)
+	return job.addContents(contents, stat, "", stat.FileName, manifestDigests, snapshotDigest)
+}
+
+// Adds the bytes read from r to n, so it ends up the size of what was read.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	*cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Returns the gzip level for a level of 1 (fastest) through 9 (best), with
+// zero selecting the default. Since gzip.NewWriterLevel accepts any level
+// returned, its error can be ignored.
+func gzipLevel(level int) (int, error) {
+	if level == 0 {
+		return gzip.DefaultCompression, nil
+	}
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return 0, fmt.Errorf("invalid gzip compression level: %d", level)
+	}
+	return level, nil
+}
+
+// Returns a FilterFunc that compresses with gzip at the specified level. Zero
+// selects the default level.
+func NewGzipFilter(level int) (FilterFunc, error) {
+	level, err := gzipLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return func(w io.Writer) io.WriteCloser {
+		zw, _ := gzip.NewWriterLevel(w, level)
+		return zw
+	}, nil
+}
+
+// Returns the encoder options for a Zstandard level, along with any others
+// given. Levels follow the zstd command line tool, e.g., 1 (fastest) through 19
+// (best), and are mapped onto the nearest level supported by the encoder. Zero
+// selects the default level. Since zstd.NewWriter accepts the options
+// returned, its error can be ignored.
+func zstdOptions(level int, opts ...zstd.EOption) ([]zstd.EOption, error) {
+	if level == 0 {
+		return opts, nil
+	}
+	if level < 1 || level > 22 {
+		return nil, fmt.Errorf("invalid zstd compression level: %d", level)
+	}
+	return append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level))), nil
+}
+
+// Returns a FilterFunc that compresses with Zstandard at the specified level,
+// as for zstdOptions.
+func NewZstdFilter(level int) (FilterFunc, error) {
+	opts, err := zstdOptions(level)
+	if err != nil {
+		return nil, err
+	}
+	return func(w io.Writer) io.WriteCloser {
+		zw, _ := zstd.NewWriter(w, opts...)
+		return zw
+	}, nil
+}
+
+// Dictionary sizes approximating the presets of the xz command line tool,
+// indexed by level.
+var xzDictCaps = []int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+// Returns a FilterFunc that compresses with LZMA2 inside the .xz container
+// format. Each block carries a CRC-64 check so `xz -t` can verify the output.
+// Levels 1 through 9 select the dictionary size like the xz presets. Zero
+// selects the default level.
+func NewXzFilter(level int) (FilterFunc, error) {
+	if level < 0 || level >= len(xzDictCaps) {
+		return nil, fmt.Errorf("invalid xz compression level: %d", level)
+	}
+	config := xz.WriterConfig{CheckSum: xz.CRC64}
+	if level != 0 {
+		config.DictCap = xzDictCaps[level]
+	}
+	if err := config.Verify(); err != nil {
+		return nil, err
+	}
+	return func(w io.Writer) io.WriteCloser {
+		// The configuration is verified above, so the writer can't fail here.
+		xw, _ := config.NewWriter(w)
+		return xw
+	}, nil
+}
+
+// Returns a FilterFunc that compresses with bzip2. Levels 1 through 9 select
+// the block size in units of 100 kB. Zero selects the default level of 9.
+func NewBzip2Filter(level int) (FilterFunc, error) {
+	if level == 0 {
+		level = 9
+	}
+	if level < 1 || level > 9 {
+		return nil, fmt.Errorf("invalid bzip2 compression level: %d", level)
+	}
+	return func(w io.Writer) io.WriteCloser {
+		// The level is validated above, so the writer can't fail here.
+		zw, _ := NewBzip2Writer(w, level)
+		return zw
+	}, nil
+}
+
+// Wraps a reader to decompress the input of an archive. The counterpart of a
+// FilterFunc.
+type UnfilterFunc func(io.Reader) (io.ReadCloser, error)
+
+// Decompresses gzip, verifying the CRC and size in the trailer of each member.
+func NewGzipUnfilter(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Decompresses Zstandard, verifying frame checksums.
+func NewZstdUnfilter(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// Decompresses the .xz container format, verifying block checks.
+func NewXzUnfilter(r io.Reader) (io.ReadCloser, error) {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(xr), nil
+}
+
+// Decompresses bzip2, verifying block and stream CRCs.
+func NewBzip2Unfilter(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
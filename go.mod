@@ -2,4 +2,11 @@ module github.com/Spidey01/zephyr
 
 go 1.23.1
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.41.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.35.0 // indirect
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// How long a hook command may run when the spec doesn't say.
+const DefaultHookTimeout = 10 * time.Minute
+
+// How long to wait for a hook's output once it has exited or been killed, in
+// case something it started is still holding on to it.
+const hookWaitDelay = 5 * time.Second
+
+// Environment variables set for hook commands, on top of zephyr's own.
+const (
+	// The spec's name.
+	HookEnvName = "ZEPHYR_NAME"
+	// The archive's path, with any template expanded.
+	HookEnvPath = "ZEPHYR_PATH"
+	// How the backup went, as in its report. Not set for before hooks.
+	HookEnvStatus = "ZEPHYR_STATUS"
+)
+
+// Runs backup with the spec's hooks around it. The before hooks run first, and
+// if any fails, so does the backup without being run. The after hooks then run
+// however the backup went, followed by the on_failure hooks if it failed. The
+// after and on_failure hooks run even if the backup was cancelled, so that
+// whatever the before hooks stopped is started again.
+func backupWithHooks(ctx context.Context, spec BackupSpec, log *Logger) (*BackupJob, error) {
+	started := time.Now()
+	path, err := spec.ExpandPath(started)
+	if err != nil {
+		return &BackupJob{Spec: &spec, Log: log, Started: started}, fmt.Errorf("path: %w", err)
+	}
+	// The spec as backed up, for reporting a failure before then.
+	expanded := spec
+	expanded.Path = path
+	job := &BackupJob{Spec: &expanded, Log: log, Started: started}
+	timeout := DefaultHookTimeout
+	if spec.HookTimeout != "" {
+		if timeout, err = time.ParseDuration(spec.HookTimeout); err != nil {
+			return job, fmt.Errorf("hook_timeout: %w", err)
+		} else if timeout <= 0 {
+			return job, fmt.Errorf("invalid hook_timeout: %s", spec.HookTimeout)
+		}
+	}
+	env := append(os.Environ(), HookEnvName+"="+spec.Name, HookEnvPath+"="+path)
+	hooks := &hookRunner{log: log, timeout: timeout, env: env}
+
+	err = hooks.run(ctx, "before", spec.Before)
+	if err == nil {
+		job, err = backup(ctx, spec, path, started, log)
+		hooks.env = append(env, HookEnvStatus+"="+job.status(err))
+		err = errors.Join(err, hooks.run(context.WithoutCancel(ctx), "after", spec.After))
+	}
+	if err != nil {
+		hooks.env = append(env, HookEnvStatus+"="+ReportFailed)
+		err = errors.Join(err, hooks.run(context.WithoutCancel(ctx), "on_failure", spec.OnFailure))
+	}
+	return job, err
+}
+
+// Runs hook commands for a backup.
+type hookRunner struct {
+	log     *Logger
+	timeout time.Duration
+	env     []string
+}
+
+// Runs the commands in order, stopping at the first to fail. Their output is
+// logged a line at a time. Nothing is run during a dry run.
+func (h *hookRunner) run(ctx context.Context, kind string, commands []string) error {
+	for _, command := range commands {
+		h.log.Detailf("Running %s hook: %s", kind, command)
+		if options.DryRun {
+			continue
+		}
+		if err := h.runOne(ctx, kind, command); err != nil {
+			return fmt.Errorf("%s hook %q: %w", kind, command, err)
+		}
+	}
+	return nil
+}
+
+func (h *hookRunner) runOne(ctx context.Context, kind, command string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Env = h.env
+	cmd.WaitDelay = hookWaitDelay
+	output := &lineLogger{log: h.log, prefix: kind + ": "}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+	output.Flush()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", h.timeout)
+	} else if err != nil && ctx.Err() != nil {
+		// Killed because the backup was cancelled.
+		return ctx.Err()
+	}
+	return err
+}
+
+// Logs what's written to it a line at a time, each after the prefix.
+type lineLogger struct {
+	log     *Logger
+	prefix  string
+	partial []byte
+}
+
+func (ll *lineLogger) Write(p []byte) (int, error) {
+	ll.partial = append(ll.partial, p...)
+	for {
+		i := bytes.IndexByte(ll.partial, '\n')
+		if i < 0 {
+			break
+		}
+		ll.logLine(ll.partial[:i])
+		ll.partial = ll.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Logs what's left of the last line.
+func (ll *lineLogger) Flush() {
+	if len(ll.partial) > 0 {
+		ll.logLine(ll.partial)
+		ll.partial = nil
+	}
+}
+
+func (ll *lineLogger) logLine(line []byte) {
+	ll.log.Infof("%s%s", ll.prefix, bytes.TrimRight(line, "\r"))
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// A single rule from an ignore file.
+type ignoreRule struct {
+	// Directory containing the ignore file, cleaned like the walked paths it's
+	// compared with. Anchored patterns are relative to it, and the rule only
+	// applies beneath it.
+	dir string
+	// Pattern split into path elements.
+	elements []string
+	// Re-includes matching paths rather than ignoring them.
+	negate bool
+	// Only matches directories.
+	dirOnly bool
+	// Where the rule came from, for logging.
+	source string
+}
+
+// Rules loaded from per-directory ignore files, using the semantics of
+// .gitignore. Each directory's rules are inherited by its subdirectories,
+// with rules closer to the path taking priority.
+type IgnoreRules struct {
+	parent *IgnoreRules
+	rules  []ignoreRule
+}
+
+// Returns the rules that apply beneath dir: those of ir plus any found in the
+// named ignore files within dir. If there are no ignore files, ir is returned.
+// A nil ir is fine and means there are no inherited rules.
+func (ir *IgnoreRules) Load(dir string, names []string) (*IgnoreRules, error) {
+	var rules []ignoreRule
+	for _, name := range names {
+		loaded, err := readIgnoreFile(dir, path.Join(dir, name))
+		if err != nil {
+			return ir, err
+		}
+		rules = append(rules, loaded...)
+	}
+	if len(rules) == 0 {
+		return ir, nil
+	}
+	return &IgnoreRules{parent: ir, rules: rules}, nil
+}
+
+// Reports whether the path should be ignored, and the rule deciding it.
+func (ir *IgnoreRules) Ignored(name string, isDir bool) (bool, string) {
+	for r := ir; r != nil; r = r.parent {
+		// Later rules override earlier ones.
+		for i := len(r.rules) - 1; i >= 0; i-- {
+			rule := &r.rules[i]
+			if rule.matches(name, isDir) {
+				return !rule.negate, rule.source
+			}
+		}
+	}
+	return false, ""
+}
+
+func (rule *ignoreRule) matches(name string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	// Paths beneath "." have no prefix at all.
+	prefix := ""
+	if rule.dir != "." {
+		prefix = strings.TrimSuffix(rule.dir, "/") + "/"
+	}
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	// Patterns were validated when loaded.
+	ok, _ := matchElements(rule.elements, strings.Split(name[len(prefix):], "/"))
+	return ok
+}
+
+// Parses the ignore file at name, which lives in dir. A missing file has no
+// rules.
+func readIgnoreFile(dir, name string) ([]ignoreRule, error) {
+	fp, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(fp)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		rule, ok, err := parseIgnoreLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineno, err)
+		}
+		if !ok {
+			continue
+		}
+		rule.dir = path.Clean(dir)
+		rule.source = fmt.Sprintf("%s:%d", name, lineno)
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Parses one line of an ignore file. Returns false if the line is blank or a
+// comment.
+func parseIgnoreLine(line string) (rule ignoreRule, ok bool, err error) {
+	// Trailing spaces are dropped unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return rule, false, nil
+	}
+	// A slash at the start or in the middle anchors the pattern to the
+	// directory of the ignore file. Otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if err = ValidatePattern(line); err != nil {
+		return rule, false, err
+	}
+	rule.elements = strings.Split(line, "/")
+	if !anchored {
+		rule.elements = append([]string{"**"}, rule.elements...)
+	}
+	// A trailing "/**" matches everything inside, but not the directory.
+	if n := len(rule.elements); n > 1 && rule.elements[n-1] == "**" {
+		rule.elements = append(rule.elements[:n-1], "*", "**")
+	}
+	return rule, true, nil
+}
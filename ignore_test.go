@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Writes the files, given by their path under dir, with the given contents.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		".ignore":     "# Build output.\n*.o\nbuild/\n/top.txt\ndocs/*.html\n!keep.o\n\\#hash\n",
+		"sub/.ignore": "keep.o\n!*.log\n",
+	})
+	root, err := (*IgnoreRules)(nil).Load(dir, []string{".ignore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := root.Load(filepath.Join(dir, "sub"), []string{".ignore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rules *IgnoreRules
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{root, "a.o", false, true},
+		{root, "deep/down/a.o", false, true},
+		{root, "keep.o", false, false},
+		{root, "build", true, true},
+		{root, "build", false, false},
+		{root, "top.txt", false, true},
+		{root, "sub/top.txt", false, false},
+		{root, "docs/index.html", false, true},
+		{root, "sub/docs/index.html", false, false},
+		{root, "#hash", false, true},
+		{root, "a.c", false, false},
+		// Deeper rules take priority.
+		{sub, "sub/keep.o", false, true},
+		{sub, "sub/a.o", false, true},
+		{sub, "keep.o", false, false},
+	}
+	for _, test := range tests {
+		got, _ := test.rules.Ignored(filepath.Join(dir, test.name), test.isDir)
+		if got != test.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", test.name, test.isDir, got, test.want)
+		}
+	}
+
+	if rules, err := root.Load(filepath.Join(dir, "missing"), []string{".ignore"}); err != nil || rules != root {
+		t.Errorf("Load() without ignore files = %v, %v, want the inherited rules", rules, err)
+	}
+	writeTestFiles(t, dir, map[string]string{"bad/.ignore": "ok\n[\n"})
+	if _, err := root.Load(filepath.Join(dir, "bad"), []string{".ignore"}); err == nil {
+		t.Errorf("Load() accepted an invalid pattern")
+	}
+}
+
+func TestWalkDirIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		".ignore":        "*.tmp\n",
+		"a.txt":          "",
+		"a.tmp":          "",
+		"readable/e.tmp": "",
+		"readable/f.txt": "",
+		// A directory can't be read as an ignore file.
+		"unreadable/.ignore/g.txt": "",
+		"unreadable/h.txt":         "",
+	})
+
+	var walked []string
+	var failed []string
+	err := WalkDir(dir, []string{".ignore"}, nil, func(name string, d fs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(dir, name)
+		if err != nil {
+			failed = append(failed, rel)
+			return nil
+		}
+		walked = append(walked, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", ".ignore", "a.txt", "readable", "readable/f.txt", "unreadable"}
+	if !slices.Equal(walked, want) {
+		t.Errorf("walked %v, want %v", walked, want)
+	}
+	if !slices.Equal(failed, []string{"unreadable"}) {
+		t.Errorf("failed %v, want [unreadable]", failed)
+	}
+
+	failure := errors.New("failed")
+	err = WalkDir(dir, []string{".ignore"}, nil, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return failure
+		}
+		return nil
+	})
+	if err != failure {
+		t.Errorf("WalkDir() = %v, want the error returned for the ignore file", err)
+	}
+}
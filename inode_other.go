@@ -0,0 +1,15 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+//go:build !unix
+
+package main
+
+import (
+	"io/fs"
+)
+
+// Returns the inode number of the file, or zero if unknown.
+func inode(stat fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+// A member of an archive as output by the list command in JSON.
+type ListEntry struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Mode     string    `json:"mode"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Linkname string    `json:"linkname,omitempty"`
+	Uid      *int      `json:"uid,omitempty"`
+	Gid      *int      `json:"gid,omitempty"`
+	Uname    string    `json:"uname,omitempty"`
+	Gname    string    `json:"gname,omitempty"`
+}
+
+// The output of the list command in JSON.
+type ListOutput struct {
+	Archive string      `json:"archive"`
+	Format  string      `json:"format"`
+	Members []ListEntry `json:"members"`
+}
+
+// Entry point for the list command, returning the exit status.
+func listCommand(args []string) int {
+	var asJSON bool
+	fs := options.NewCommandFlagSet("list", "archive",
+		"Lists the members of the archive, like tar -tv. Given a repository, lists its snapshots.")
+	fs.BoolVar(&asJSON, "json", false, "Output the listing as JSON.")
+	options.ParseCommand(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 64 // EX_USAGE.
+	}
+	list := List
+	if IsRepository(fs.Arg(0)) {
+		list = ListSnapshots
+	}
+	if err := list(os.Stdout, fs.Arg(0), asJSON); err != nil {
+		Errorf("Listing %s failed: %v", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+// Writes a listing of the archive at the path name to w, either as text or as
+// a ListOutput in JSON.
+func List(w io.Writer, name string, asJSON bool) error {
+	format, err := DetectFormat(name)
+	if err != nil {
+		return err
+	}
+	Verbosef("%s: %s archive", name, format.Names[0])
+	ar, err := format.Open(name)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	output := ListOutput{
+		Archive: name,
+		Format:  format.Names[0],
+		Members: []ListEntry{},
+	}
+	for {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if asJSON {
+			output.Members = append(output.Members, NewListEntry(entry))
+		} else {
+			fmt.Fprintln(w, FormatEntry(entry))
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(output)
+	}
+	return nil
+}
+
+// Returns the JSON form of the entry.
+func NewListEntry(entry *ArchiveEntry) ListEntry {
+	le := ListEntry{
+		Name:     entry.Name,
+		Type:     EntryType(entry),
+		Size:     entry.Size,
+		ModTime:  entry.ModTime,
+		Linkname: entry.Linkname,
+	}
+	if entry.HasOwner {
+		le.Uid, le.Gid = &entry.Uid, &entry.Gid
+		le.Uname, le.Gname = entry.Uname, entry.Gname
+	}
+	// The set-id and sticky bits need to be in their Unix places.
+	mode := uint32(entry.Mode.Perm())
+	if entry.Mode&fs.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if entry.Mode&fs.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if entry.Mode&fs.ModeSticky != 0 {
+		mode |= 01000
+	}
+	le.Mode = fmt.Sprintf("%04o", mode)
+	return le
+}
+
+// Returns a short name for the type of the entry.
+func EntryType(entry *ArchiveEntry) string {
+	switch {
+	case entry.HardLink:
+		return "hardlink"
+	case entry.Mode.IsDir():
+		return "dir"
+	case entry.Mode.IsRegular():
+		return "file"
+	case entry.Mode&fs.ModeSymlink != 0:
+		return "symlink"
+	case entry.Mode&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case entry.Mode&fs.ModeCharDevice != 0:
+		return "chardev"
+	case entry.Mode&fs.ModeDevice != 0:
+		return "blockdev"
+	default:
+		return "other"
+	}
+}
+
+// Formats the entry as a line of text, similar to tar -tv.
+func FormatEntry(entry *ArchiveEntry) string {
+	owner := "-"
+	if entry.HasOwner {
+		user, group := entry.Uname, entry.Gname
+		if user == "" {
+			user = strconv.Itoa(entry.Uid)
+		}
+		if group == "" {
+			group = strconv.Itoa(entry.Gid)
+		}
+		owner = user + "/" + group
+	}
+	line := fmt.Sprintf("%s %s %10d %s %s", ModeString(entry), owner, entry.Size,
+		entry.ModTime.Local().Format("2006-01-02 15:04"), entry.Name)
+	if entry.HardLink {
+		line += " link to " + entry.Linkname
+	} else if entry.Linkname != "" {
+		line += " -> " + entry.Linkname
+	}
+	return line
+}
+
+// Returns the type and permissions of the entry in the style of ls -l, which
+// differs from fs.FileMode.String() in where the set-id and sticky bits go.
+func ModeString(entry *ArchiveEntry) string {
+	var types = map[string]byte{
+		"hardlink": 'h', "dir": 'd', "symlink": 'l', "fifo": 'p',
+		"chardev": 'c', "blockdev": 'b',
+	}
+	mode := []byte("----------")
+	if c, ok := types[EntryType(entry)]; ok {
+		mode[0] = c
+	}
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if entry.Mode&(1<<(8-i)) != 0 {
+			mode[i+1] = rwx[i]
+		}
+	}
+	special := func(bit fs.FileMode, i int, set, unset byte) {
+		if entry.Mode&bit == 0 {
+			return
+		}
+		if mode[i] == 'x' {
+			mode[i] = set
+		} else {
+			mode[i] = unset
+		}
+	}
+	special(fs.ModeSetuid, 3, 's', 'S')
+	special(fs.ModeSetgid, 6, 's', 'S')
+	special(fs.ModeSticky, 9, 't', 'T')
+	return string(mode)
+}
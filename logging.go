@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024-2025, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 package main
 
 import (
@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 )
 
 type LogLevel int
@@ -88,19 +89,45 @@ func LogMsg(prefix LogLevel, format string, args ...any) {
 	}
 }
 
+// Serializes writes to the output streams, so that messages written by jobs
+// running in parallel don't interleave.
+var outputMutex sync.Mutex
+
+// A line kept at the bottom of the terminal on stderr, such as a progress
+// line, which other messages are written above.
+var statusLine string
+
+// Replaces the status line, or clears it if line is empty.
+func SetStatusLine(line string) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	io.WriteString(os.Stderr, "\r\x1b[K"+line)
+	statusLine = line
+}
+
 // Like LogMsg but writes to output stream. If format does not end in a new
 // line, one will be added. if prefix does not end in space, one will be
-// inserted.
+// inserted. The message is written all at once.
 func FmtMsg(w io.Writer, prefix, format string, args ...any) {
+	var b strings.Builder
 	if prefix != "" {
-		fmt.Fprint(w, prefix)
-		if !strings.HasSuffix(format, " ") {
-			fmt.Fprint(w, " ")
+		b.WriteString(prefix)
+		if !strings.HasSuffix(prefix, " ") {
+			b.WriteString(" ")
 		}
 	}
-	fmt.Fprintf(os.Stderr, format, args...)
+	fmt.Fprintf(&b, format, args...)
 	if !strings.HasSuffix(format, "\n") {
-		fmt.Fprint(w, "\n")
+		b.WriteString("\n")
+	}
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if statusLine != "" {
+		io.WriteString(os.Stderr, "\r\x1b[K")
+	}
+	io.WriteString(w, b.String())
+	if statusLine != "" {
+		io.WriteString(os.Stderr, statusLine)
 	}
 }
 
@@ -147,3 +174,83 @@ func Die(format string, args ...any) {
 	LogMsg(LogLevelFatal, format, args...)
 	os.Exit(1)
 }
+
+// Writes messages on behalf of one of several things going on at once, such as
+// backup jobs running in parallel, prefixing them with Prefix to tell them
+// apart. The methods are otherwise like the functions of the same names, which
+// is what a nil Logger amounts to.
+type Logger struct {
+	Prefix string
+	// Drops the messages instead, for work that's reported elsewhere.
+	Quiet bool
+}
+
+// A Logger dropping every message.
+var quietLogger = &Logger{Quiet: true}
+
+// Returns a Logger prefixing messages with the name in brackets.
+func NewLogger(name string) *Logger {
+	return &Logger{Prefix: "[" + name + "]"}
+}
+
+// Reports whether messages are dropped.
+func (l *Logger) quiet() bool {
+	return l != nil && l.Quiet
+}
+
+// Returns the format and args with the prefix added.
+func (l *Logger) prefixed(format string, args []any) (string, []any) {
+	if l == nil || l.Prefix == "" {
+		return format, args
+	}
+	return "%s " + format, append([]any{l.Prefix}, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	if l.quiet() {
+		return
+	}
+	format, args = l.prefixed(format, args)
+	Debugf(format, args...)
+}
+
+func (l *Logger) Verbosef(format string, args ...any) {
+	if l.quiet() {
+		return
+	}
+	format, args = l.prefixed(format, args)
+	Verbosef(format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	if l.quiet() {
+		return
+	}
+	format, args = l.prefixed(format, args)
+	Infof(format, args...)
+}
+
+func (l *Logger) Warningf(format string, args ...any) {
+	if l.quiet() {
+		return
+	}
+	format, args = l.prefixed(format, args)
+	Warningf(format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	if l.quiet() {
+		return
+	}
+	format, args = l.prefixed(format, args)
+	Errorf(format, args...)
+}
+
+// Like logDetail.
+func (l *Logger) Detailf(format string, args ...any) {
+	if l.quiet() {
+		return
+	}
+	format, args = l.prefixed(format, args)
+	logDetail(format, args...)
+}
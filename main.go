@@ -1,12 +1,15 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024-2025, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 package main
 
 import (
 	"context"
-	"fmt"
-	"io/fs"
+	"errors"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 )
 
 var options = NewOptions()
@@ -14,94 +17,146 @@ var options = NewOptions()
 func main() {
 	options.MustParseArgs()
 	SetupLogging(options.Name(), options.LogLevel, options.LogFile)
+	if args := options.Args(); len(args) > 0 {
+		switch args[0] {
+		case "list":
+			os.Exit(listCommand(args[1:]))
+		case "prune":
+			os.Exit(pruneCommand(args[1:]))
+		case "restore":
+			os.Exit(restoreCommand(args[1:]))
+		case "verify":
+			os.Exit(verifyCommand(args[1:]))
+		}
+	}
+	var specs []BackupSpec
 	for _, arg := range options.Args() {
 		Verbosef("Parsing %s", arg)
-		specs, err := BackupSpecsFromFile(arg)
+		more, err := BackupSpecsFromFile(arg)
 		if err != nil {
 			Die("unable to load %s\n%v\n", arg, err)
 		}
-		for i, spec := range specs {
-			Verbosef("Running backup %d: %s", i, spec)
-			err = backup(context.Background(), spec)
-			if err != nil {
-				Fatalf("Backup %s failed: %v", spec.Name, err)
-			}
-		}
+		specs = append(specs, more...)
 	}
+	// Interrupting stops the backups, which then clean up after themselves.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	status := runBackups(ctx, specs, options.Jobs)
+	stop()
+	os.Exit(status)
 }
 
-// Executes the backup specification using the provided context. Returns nil
-// once the job is complete, or an error is the operation failed.
-func backup(ctx context.Context, spec BackupSpec) error {
-	archive, err := CreateArchive(spec.Path, spec.Format)
-	if err != nil {
-		return err
+// Runs the backups, up to jobs at once, and returns the exit status. When
+// running more than one at once, their messages are prefixed with the spec
+// name. A backup failing under the abort policy cancels those still running,
+// and those not yet started are never run.
+func runBackups(ctx context.Context, specs []BackupSpec, jobs int) int {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if options.Progress && !options.DryRun {
+		progress = StartProgress()
 	}
-	defer archive.Close()
-	Verbosef("Archiving contents...")
-	for _, fn := range spec.Contents {
-		if err = ctx.Err(); err != nil {
-			return err
-		}
-		stat, err := os.Stat(fn)
-		if err != nil {
-			Warningf("Skipping %s: %v", fn, err)
-			continue
-		}
-		Verbosef("Inspecting %s (%s)", fn, fs.FormatFileInfo(stat))
-		if stat.IsDir() {
-			Infof("Adding directory tree %s", fn)
-			err = backupDir(archive, fn)
-		} else {
-			Infof("Adding file %s", fn)
-			err = backupFile(archive, stat, fn)
-		}
-		if err != nil {
-			Errorf("Failed to backup %s: %v", fn, err)
+	// Results by spec, so they're reported in order.
+	errs := make([]error, len(specs))
+	skipped := make([][]*FileError, len(specs))
+	reports := make([]*BackupReport, len(specs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if ctx.Err() != nil {
+					// Cancelled while being queued.
+					continue
+				}
+				spec := specs[i]
+				var log *Logger
+				if jobs > 1 {
+					log = NewLogger(spec.Name)
+				}
+				log.Verbosef("Running backup %d: %s", i, spec.Name)
+				job, err := backupWithHooks(ctx, spec, log)
+				skipped[i], errs[i] = job.Skipped, err
+				if err != nil {
+					log.Errorf("Backup %s failed: %v", spec.Name, err)
+				}
+				if spec.Report != "" || options.Report != "" {
+					// Checksumming the archive for the report takes reading it.
+					reports[i] = job.Report(err)
+				}
+				if spec.Report != "" {
+					if rerr := WriteReport(spec.Report, reports[i]); rerr != nil {
+						log.Errorf("Writing report %s failed: %v", spec.Report, rerr)
+						errs[i] = errors.Join(err, rerr)
+					}
+				}
+				if errs[i] != nil && (spec.OnError == "" || spec.OnError == OnErrorAbort) {
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := range specs {
+		if ctx.Err() != nil {
 			break
 		}
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+		}
 	}
-	return nil
-}
+	close(queue)
+	wg.Wait()
+	progress.Stop()
 
-// Adds the specified file to the archive.
-func backupFile(archive Archive, stat fs.FileInfo, path string) error {
-	fp, err := os.Open(path)
-	if err != nil {
-		return err
+	var failed []string
+	var allSkipped []*FileError
+	runReports := []*BackupReport{}
+	for i, spec := range specs {
+		if errs[i] != nil {
+			failed = append(failed, spec.Name)
+		}
+		allSkipped = append(allSkipped, skipped[i]...)
+		if reports[i] != nil {
+			runReports = append(runReports, reports[i])
+		}
 	}
-	defer fp.Close()
-	if options.DryRun {
-		return nil
+	status := summarize(failed, allSkipped)
+	if options.Report != "" {
+		if err := WriteReport(options.Report, runReports); err != nil {
+			Errorf("Writing report %s failed: %v", options.Report, err)
+			status = ExitFailure
+		}
 	}
-	return archive.AddFile(fp, stat, path)
+	return status
 }
 
-// Recursively adds the specified root to the archive.
-func backupDir(archive Archive, root string) error {
-	fn := func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			// N.B. if err is set, d is nil.
-			Debugf("walkDirFunc(%s, nil, %v)", path, err)
-			// We can return nil or fs.SkipDir/fs.SkipAll to ignore this tree,
-			// or an error to bork the operation.
-			return err
-		} else {
-			Debugf("walkDirFunc(%s, %s, %v)", path, fs.FormatDirEntry(d), err)
-		}
-		// Since it's valid on files and directories, we can stat before caring
-		// which it references.
-		stat, err := d.Info()
-		if err != nil {
-			return fmt.Errorf("stat %q failed: %w", path, err)
-		}
-		if !d.IsDir() {
-			return backupFile(archive, stat, path)
-		}
-		if options.DryRun {
-			return nil
+// Exit statuses of a backup run.
+const (
+	// Every backup succeeded.
+	ExitSuccess = 0
+	// A backup failed.
+	ExitFailure = 1
+	// Every backup succeeded, but some files were skipped.
+	ExitPartial = 2
+)
+
+// Reports the backups that failed and the files that were skipped, returning
+// the exit status.
+func summarize(failed []string, skipped []*FileError) int {
+	if len(skipped) > 0 {
+		Warningf("%d files were skipped:", len(skipped))
+		for _, ferr := range skipped {
+			Warningf("  %v", ferr)
 		}
-		return archive.AddDir(d, stat, path)
 	}
-	return WalkDir(root, fn)
+	if len(failed) > 0 {
+		Errorf("%d backups failed: %s", len(failed), strings.Join(failed, ", "))
+		return ExitFailure
+	} else if len(skipped) > 0 {
+		return ExitPartial
+	}
+	return ExitSuccess
 }
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// A hash algorithm that manifests can be computed with.
+type HashAlgorithm struct {
+	// Name used in a ManifestSpec, and the extension of sidecar manifests.
+	Name string
+	// Name used by the tagged (BSD) checksum format.
+	Tag string
+	// Command that checks the whole archive digest, and the extension of the
+	// file it's written to.
+	Tool string
+	New  func() hash.Hash
+}
+
+var HashAlgorithms = []*HashAlgorithm{
+	{Name: "sha256", Tag: "SHA256", Tool: "sha256sum", New: sha256.New},
+	{Name: "sha512", Tag: "SHA512", Tool: "sha512sum", New: sha512.New},
+	{Name: "blake2b", Tag: "BLAKE2b", Tool: "b2sum", New: func() hash.Hash {
+		// Only fails for a bad key, and there is none.
+		h, _ := blake2b.New512(nil)
+		return h
+	}},
+}
+
+// Returns the algorithm with the given name.
+func LookupHashAlgorithm(name string) (*HashAlgorithm, error) {
+	for _, alg := range HashAlgorithms {
+		if alg.Name == name {
+			return alg, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm: %s", name)
+}
+
+// Collects the checksums of the files added to an archive.
+type Manifest struct {
+	Algorithms []*HashAlgorithm
+	// Where messages go.
+	Log     *Logger
+	entries []manifestEntry
+}
+
+type manifestEntry struct {
+	name string
+	// In the same order as Algorithms.
+	sums [][]byte
+}
+
+// Returns a new Manifest computing the named algorithms, or SHA-256 if none.
+func NewManifest(algorithms []string) (*Manifest, error) {
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha256"}
+	}
+	m := &Manifest{}
+	for _, name := range algorithms {
+		alg, err := LookupHashAlgorithm(name)
+		if err != nil {
+			return nil, err
+		}
+		m.Algorithms = append(m.Algorithms, alg)
+	}
+	return m, nil
+}
+
+// Returns a new hash for each algorithm, to be written with the contents of a
+// file and then passed to Add.
+func (m *Manifest) NewDigests() []hash.Hash {
+	digests := make([]hash.Hash, len(m.Algorithms))
+	for i, alg := range m.Algorithms {
+		digests[i] = alg.New()
+	}
+	return digests
+}
+
+// Records the digests of the file archived as name.
+func (m *Manifest) Add(name string, digests []hash.Hash) {
+	entry := manifestEntry{name: name}
+	for _, digest := range digests {
+		entry.sums = append(entry.sums, digest.Sum(nil))
+	}
+	m.entries = append(m.entries, entry)
+}
+
+// Writes the checksums of one algorithm, by index into Algorithms, in the
+// format of sha256sum and friends.
+func (m *Manifest) WriteSums(w io.Writer, index int) error {
+	for _, entry := range m.entries {
+		if err := writeSumLine(w, entry.sums[index], entry.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the checksums of every algorithm in the tagged format, as written by
+// sha256sum --tag and understood by cksum -c.
+func (m *Manifest) WriteTagged(w io.Writer) error {
+	for _, entry := range m.entries {
+		name, escaped := escapeSumName(entry.name)
+		for i, alg := range m.Algorithms {
+			line := fmt.Sprintf("%s (%s) = %s\n", alg.Tag, name, hex.EncodeToString(entry.sums[i]))
+			if escaped {
+				line = "\\" + line
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Writes a manifest next to the archive for each algorithm, named after the
+// archive with the algorithm as the extension.
+func (m *Manifest) WriteSidecars(archive string) error {
+	for i, alg := range m.Algorithms {
+		name := archive + "." + alg.Name
+		m.Log.Verbosef("Writing manifest %s", name)
+		var buf bytes.Buffer
+		if err := m.WriteSums(&buf, i); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds the manifest to the archive as the member name, in the tagged format so
+// that every algorithm can go in the one file.
+func (m *Manifest) AddTo(archive Archive, name string) error {
+	var buf bytes.Buffer
+	if err := m.WriteTagged(&buf); err != nil {
+		return err
+	}
+	m.Log.Verbosef("Adding manifest %s", FormatName(archive, name))
+	stat := &SyntheticFileInfo{
+		FileName:    name,
+		FileSize:    int64(buf.Len()),
+		FileMode:    0644,
+		FileModTime: time.Now(),
+	}
+	return archive.AddFile(&buf, stat, "", name)
+}
+
+// Writes the digest of the whole archive for each algorithm, so that it can be
+// checked with the likes of sha256sum -c from the archive's directory.
+func (m *Manifest) WriteArchiveDigests(archive string) error {
+	digests := m.NewDigests()
+	fp, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if _, err := io.Copy(multiWriter(digests), fp); err != nil {
+		return err
+	}
+	for i, alg := range m.Algorithms {
+		name := archive + "." + alg.Tool
+		m.Log.Verbosef("Writing digest %s", name)
+		var buf bytes.Buffer
+		writeSumLine(&buf, digests[i].Sum(nil), path.Base(archive))
+		if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a writer that writes to every digest.
+func multiWriter(digests []hash.Hash) io.Writer {
+	writers := make([]io.Writer, len(digests))
+	for i, digest := range digests {
+		writers[i] = digest
+	}
+	return io.MultiWriter(writers...)
+}
+
+// Writes a line of sha256sum output for the named file.
+func writeSumLine(w io.Writer, sum []byte, name string) error {
+	name, escaped := escapeSumName(name)
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum), name)
+	if escaped {
+		line = "\\" + line
+	}
+	_, err := io.WriteString(w, line)
+	return err
+}
+
+// Escapes backslashes and new lines the way coreutils does, which is signaled
+// by starting the line with a backslash.
+func escapeSumName(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return name, false
+	}
+	name = strings.ReplaceAll(name, "\\", "\\\\")
+	name = strings.ReplaceAll(name, "\n", "\\n")
+	name = strings.ReplaceAll(name, "\r", "\\r")
+	return name, true
+}
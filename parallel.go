@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Sizes of the blocks compressed independently by the parallel filters. Each
+// block costs a gzip member or zstd frame header, and loses the history of the
+// blocks before it, so they're a good deal larger than the window of either.
+const (
+	ParallelGzipBlockSize = 1 << 20
+	ParallelZstdBlockSize = 4 << 20
+)
+
+// Compresses its input on several goroutines. The input is split into blocks
+// that are each compressed independently, into a complete gzip member or zstd
+// frame, and written in order. Decompressors treat such a sequence as one
+// stream, the same way they treat the output of pigz. At most twice as many
+// blocks as there are threads are in memory at once.
+type ParallelWriter struct {
+	w         io.Writer
+	compress  func([]byte) ([]byte, error)
+	blockSize int
+	block     []byte
+	// Whether any block has been compressed, since an empty stream still
+	// needs one.
+	started bool
+	// Results of the blocks being compressed, in order, each delivering one.
+	queue chan chan parallelResult
+	// Limits the blocks being compressed at once.
+	threads chan struct{}
+	// Closed once the writer goroutine has finished.
+	done chan struct{}
+	// The first error from compressing or writing, once there is one.
+	mutex  sync.Mutex
+	err    error
+	closed bool
+}
+
+type parallelResult struct {
+	data []byte
+	err  error
+}
+
+// Creates a ParallelWriter compressing blocks of blockSize bytes with compress
+// on up to threads goroutines, and writing the results to w. Compress must be
+// safe to call from several goroutines at once.
+func NewParallelWriter(w io.Writer, threads, blockSize int, compress func([]byte) ([]byte, error)) *ParallelWriter {
+	pw := &ParallelWriter{
+		w:         w,
+		compress:  compress,
+		blockSize: blockSize,
+		block:     make([]byte, 0, blockSize),
+		queue:     make(chan chan parallelResult, threads),
+		threads:   make(chan struct{}, threads),
+		done:      make(chan struct{}),
+	}
+	go pw.writeResults()
+	return pw
+}
+
+// Writes the compressed blocks in order as they become ready.
+func (pw *ParallelWriter) writeResults() {
+	defer close(pw.done)
+	for result := range pw.queue {
+		r := <-result
+		if pw.error() != nil {
+			// Drain the queue so the blocks still in flight finish.
+			continue
+		}
+		err := r.err
+		if err == nil {
+			_, err = pw.w.Write(r.data)
+		}
+		if err != nil {
+			pw.setError(err)
+		}
+	}
+}
+
+func (pw *ParallelWriter) error() error {
+	pw.mutex.Lock()
+	defer pw.mutex.Unlock()
+	return pw.err
+}
+
+func (pw *ParallelWriter) setError(err error) {
+	pw.mutex.Lock()
+	defer pw.mutex.Unlock()
+	if pw.err == nil {
+		pw.err = err
+	}
+}
+
+// Starts compressing the current block, blocking while all threads are busy.
+func (pw *ParallelWriter) flushBlock() {
+	block := pw.block
+	pw.block = make([]byte, 0, pw.blockSize)
+	pw.started = true
+	result := make(chan parallelResult, 1)
+	pw.threads <- struct{}{}
+	pw.queue <- result
+	go func() {
+		data, err := pw.compress(block)
+		<-pw.threads
+		result <- parallelResult{data, err}
+	}()
+}
+
+func (pw *ParallelWriter) Write(p []byte) (int, error) {
+	if pw.closed {
+		return 0, errors.New("write to closed ParallelWriter")
+	}
+	n := 0
+	for len(p) > 0 {
+		if err := pw.error(); err != nil {
+			return n, err
+		}
+		m := min(len(p), pw.blockSize-len(pw.block))
+		pw.block = append(pw.block, p[:m]...)
+		n += m
+		p = p[m:]
+		if len(pw.block) == pw.blockSize {
+			pw.flushBlock()
+		}
+	}
+	return n, nil
+}
+
+// Compresses what remains and waits for everything to be written. Doesn't
+// close the underlying writer.
+func (pw *ParallelWriter) Close() error {
+	if pw.closed {
+		return pw.error()
+	}
+	pw.closed = true
+	if len(pw.block) > 0 || !pw.started {
+		pw.flushBlock()
+	}
+	close(pw.queue)
+	<-pw.done
+	return pw.error()
+}
+
+// Returns an error if threads isn't a usable number of compression threads.
+func checkThreads(threads int) error {
+	if threads < 1 {
+		return fmt.Errorf("invalid threads: %d", threads)
+	}
+	return nil
+}
+
+// Returns a FilterFunc like that of NewGzipFilter, but compressing on threads
+// goroutines, writing a gzip member for each block.
+func NewParallelGzipFilter(level, threads int) (FilterFunc, error) {
+	if err := checkThreads(threads); err != nil {
+		return nil, err
+	}
+	level, err := gzipLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	writers := sync.Pool{
+		New: func() any {
+			zw, _ := gzip.NewWriterLevel(nil, level)
+			return zw
+		},
+	}
+	compress := func(block []byte) ([]byte, error) {
+		var b bytes.Buffer
+		zw := writers.Get().(*gzip.Writer)
+		defer writers.Put(zw)
+		zw.Reset(&b)
+		if _, err := zw.Write(block); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	return func(w io.Writer) io.WriteCloser {
+		return NewParallelWriter(w, threads, ParallelGzipBlockSize, compress)
+	}, nil
+}
+
+// Returns a FilterFunc like that of NewZstdFilter, but compressing on threads
+// goroutines, writing a zstd frame for each block.
+func NewParallelZstdFilter(level, threads int) (FilterFunc, error) {
+	if err := checkThreads(threads); err != nil {
+		return nil, err
+	}
+	opts, err := zstdOptions(level, zstd.WithEncoderConcurrency(threads))
+	if err != nil {
+		return nil, err
+	}
+	return func(w io.Writer) io.WriteCloser {
+		encoder, _ := zstd.NewWriter(nil, opts...)
+		compress := func(block []byte) ([]byte, error) {
+			// EncodeAll is safe to use from up to the encoder's concurrency
+			// goroutines at once.
+			return encoder.EncodeAll(block, nil), nil
+		}
+		return &zstdParallelWriter{NewParallelWriter(w, threads, ParallelZstdBlockSize, compress), encoder}
+	}, nil
+}
+
+// Releases the encoder along with the ParallelWriter.
+type zstdParallelWriter struct {
+	*ParallelWriter
+	encoder *zstd.Encoder
+}
+
+func (zw *zstdParallelWriter) Close() error {
+	err := zw.ParallelWriter.Close()
+	zw.encoder.Close()
+	return err
+}
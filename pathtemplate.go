@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// The values available to a BackupSpec.Path template, such as
+// "/backups/{{.Name}}-{{.Time "2006-01-02T150405"}}.{{.Ext}}".
+type PathTemplateData struct {
+	// Name of the spec.
+	Name string
+	// Extension of the archive, which is the format as written in the spec.
+	Ext string
+	// When the backup started.
+	Started time.Time
+	// Expand to a glob pattern matching any time, instead of Started.
+	glob bool
+	// Expand each time to timeMarker instead, adding the regular expression
+	// matching it to times.
+	regexp bool
+	times  []string
+}
+
+// Stands in for times in a path being turned into a regular expression, which
+// a path can't contain.
+const timeMarker = "\x00"
+
+// Returns when the backup started, formatted by the layout of time.Format.
+func (d *PathTemplateData) Time(layout string) string {
+	if d.glob {
+		return "*"
+	} else if d.regexp {
+		d.times = append(d.times, layoutRegexp(layout))
+		return timeMarker
+	}
+	return d.Started.Format(layout)
+}
+
+// Returns a regular expression matching times formatted by the layout. It's
+// worked out from the current time so formatted, with runs of digits matching
+// any number and runs of letters matching any word, such as a month name.
+func layoutRegexp(layout string) string {
+	var b strings.Builder
+	formatted := []rune(time.Now().Format(layout))
+	for i := 0; i < len(formatted); {
+		j := i + 1
+		switch r := formatted[i]; {
+		case unicode.IsDigit(r) || r == ' ':
+			// Spaces pad some numbers, such as the day with "_2".
+			for j < len(formatted) && (unicode.IsDigit(formatted[j]) || formatted[j] == ' ') {
+				j++
+			}
+			b.WriteString("[ 0-9]+")
+		case unicode.IsLetter(r):
+			for j < len(formatted) && unicode.IsLetter(formatted[j]) {
+				j++
+			}
+			b.WriteString("[[:alpha:]]+")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// Returns the host name of this machine.
+func (d *PathTemplateData) Hostname() (string, error) {
+	name, err := os.Hostname()
+	return d.value(name), err
+}
+
+// Returns the value of an environment variable, which must be set.
+func (d *PathTemplateData) Env(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return d.value(value), nil
+}
+
+// Returns a value substituted into the path, escaped when expanding to a glob
+// pattern so that it only matches itself.
+func (d *PathTemplateData) value(s string) string {
+	if d.glob {
+		return globEscape(s)
+	}
+	return s
+}
+
+// Puts the characters special to filepath.Match in brackets, which works
+// whether or not the platform uses backslash to escape them.
+var globEscaper = strings.NewReplacer(`*`, `[*]`, `?`, `[?]`, `[`, `[[]`, `\`, `[\\]`)
+
+// Returns s escaped so that it's a glob pattern matching only itself.
+func globEscape(s string) string {
+	return globEscaper.Replace(s)
+}
+
+// Returns the spec's path with any template expanded for a backup started at
+// the given time. Paths without "{{" are returned as is.
+func (spec *BackupSpec) ExpandPath(started time.Time) (string, error) {
+	return spec.expandPath(&PathTemplateData{
+		Name:    spec.Name,
+		Ext:     spec.Format,
+		Started: started,
+	})
+}
+
+// Returns a glob pattern matching the paths that the spec's path expands to
+// at any time. Only the times are wildcards; the values substituted for the
+// other fields are escaped.
+func (spec *BackupSpec) PathGlob() (string, error) {
+	data := &PathTemplateData{glob: true}
+	data.Name = data.value(spec.Name)
+	data.Ext = data.value(spec.Format)
+	return spec.expandPath(data)
+}
+
+// Returns a regular expression matching only the paths that the spec's path
+// expands to, at any time. Unlike the pattern from PathGlob, the part of the
+// path from each time has to look like a time, so the paths of other specs
+// that also match the pattern can be told apart.
+func (spec *BackupSpec) PathRegexp() (*regexp.Regexp, error) {
+	data := &PathTemplateData{
+		Name:   spec.Name,
+		Ext:    spec.Format,
+		regexp: true,
+	}
+	expanded, err := spec.expandPath(data)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i, literal := range strings.Split(expanded, timeMarker) {
+		if i > 0 {
+			b.WriteString(data.times[i-1])
+		}
+		b.WriteString(regexp.QuoteMeta(literal))
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func (spec *BackupSpec) expandPath(data *PathTemplateData) (string, error) {
+	if !strings.Contains(spec.Path, "{{") {
+		return spec.Path, nil
+	}
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(spec.Path)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPathGlobEscapes(t *testing.T) {
+	t.Setenv("ZEPHYR_TEST_DIR", "dir[1]")
+	spec := &BackupSpec{
+		Name:   `a*b?c\d`,
+		Format: "tgz",
+		Path:   `/backup/{{.Env "ZEPHYR_TEST_DIR"}}/{{.Name}}-{{.Time "2006-01-02"}}.{{.Ext}}`,
+	}
+	glob, err := spec.PathGlob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	expanded, err := spec.ExpandPath(started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `/backup/dir[1]/a*b?c\d-2026-10-16.tgz`; expanded != want {
+		t.Errorf("ExpandPath() = %q, want %q", expanded, want)
+	}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{expanded, true},
+		{`/backup/dir[1]/a*b?c\d-2025-01-01.tgz`, true},
+		{`/backup/dir1/a*b?c\d-2026-10-16.tgz`, false},
+		{`/backup/dir[1]/aXb?c\d-2026-10-16.tgz`, false},
+		{`/backup/dir[1]/a*bXc\d-2026-10-16.tgz`, false},
+		{`/backup/dir[1]/a*b?cd-2026-10-16.tgz`, false},
+	}
+	for _, test := range tests {
+		got, err := filepath.Match(glob, test.name)
+		if err != nil {
+			t.Fatalf("filepath.Match(%q): %v", glob, err)
+		}
+		if got != test.want {
+			t.Errorf("PathGlob() = %q matches %q: %v, want %v", glob, test.name, got, test.want)
+		}
+	}
+
+	match, err := spec.PathRegexp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if got := match.MatchString(test.name); got != test.want {
+			t.Errorf("PathRegexp() = %v matches %q: %v, want %v", match, test.name, got, test.want)
+		}
+	}
+}
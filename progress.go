@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// How often progress is logged when standard error isn't a terminal. On a
+// terminal, the progress line is redrawn several times a second.
+const ProgressLogInterval = 30 * time.Second
+
+// Tracks how far along the running backups are. Each backup adds what its
+// scan finds to the totals before it starts archiving.
+type Progress struct {
+	totalFiles, totalBytes atomic.Int64
+	files, bytes           atomic.Int64
+	started                time.Time
+	// Whether standard error is a terminal, to draw the progress line on.
+	terminal bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// The progress of the backups being run, or nil when not reporting progress.
+// The methods of a nil Progress do nothing, so it can be updated regardless.
+var progress *Progress
+
+// Starts reporting progress until Stop is called.
+func StartProgress() *Progress {
+	p := &Progress{
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if stat, err := os.Stderr.Stat(); err == nil {
+		p.terminal = stat.Mode()&fs.ModeCharDevice != 0
+	}
+	go p.report()
+	return p
+}
+
+// Reports progress periodically until stopped.
+func (p *Progress) report() {
+	defer close(p.done)
+	interval := ProgressLogInterval
+	if p.terminal {
+		interval = 250 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if p.terminal {
+				SetStatusLine(p.String())
+			} else {
+				Infof("Progress: %s", p)
+			}
+		case <-p.stop:
+			if p.terminal {
+				SetStatusLine("")
+			}
+			return
+		}
+	}
+}
+
+// Stops reporting progress, and logs a summary of what was done.
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	elapsed := time.Since(p.started)
+	Infof("Archived %d files, %s in %s, %s/s", p.files.Load(), formatBytes(p.bytes.Load()),
+		elapsed.Round(time.Second), formatBytes(p.rate(elapsed)))
+}
+
+// Adds a backup's files and bytes to the totals.
+func (p *Progress) AddTotal(files, bytes int64) {
+	if p == nil {
+		return
+	}
+	p.totalFiles.Add(files)
+	p.totalBytes.Add(bytes)
+}
+
+// Counts a file as archived.
+func (p *Progress) AddFile() {
+	if p == nil {
+		return
+	}
+	p.files.Add(1)
+}
+
+// Counts bytes as archived.
+func (p *Progress) AddBytes(n int64) {
+	if p == nil {
+		return
+	}
+	p.bytes.Add(n)
+}
+
+// Returns the bytes archived per second so far.
+func (p *Progress) rate(elapsed time.Duration) int64 {
+	if elapsed < time.Second {
+		return p.bytes.Load()
+	}
+	return int64(float64(p.bytes.Load()) / elapsed.Seconds())
+}
+
+// Describes the progress, e.g., "42% 1.2 GiB of 2.9 GiB, 310 of 982 files,
+// 85.3 MiB/s, ETA 21s".
+func (p *Progress) String() string {
+	bytes, totalBytes := p.bytes.Load(), p.totalBytes.Load()
+	// Files can grow while they're archived, and the totals only grow as
+	// more backups start.
+	totalBytes = max(bytes, totalBytes)
+	percent := int64(100)
+	if totalBytes > 0 {
+		percent = bytes * 100 / totalBytes
+	}
+	elapsed := time.Since(p.started)
+	rate := p.rate(elapsed)
+	eta := "unknown"
+	if rate > 0 {
+		remaining := time.Duration(float64(totalBytes-bytes) / float64(rate) * float64(time.Second))
+		eta = remaining.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%d%% %s of %s, %d of %d files, %s/s, ETA %s", percent,
+		formatBytes(bytes), formatBytes(totalBytes), p.files.Load(),
+		max(p.files.Load(), p.totalFiles.Load()), formatBytes(rate), eta)
+}
+
+// Formats a number of bytes in binary units, e.g., "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Counts the bytes read through it as archived.
+type progressReader struct {
+	r io.Reader
+}
+
+func (pr progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	progress.AddBytes(int64(n))
+	return n, err
+}
+
+// Adds the files and bytes to be archived to the progress totals, by walking
+// the spec's contents the same way archiveContents does, without logging.
+// Files unchanged since the previous backup aren't counted.
+func (job *BackupJob) scan() {
+	var files, bytes int64
+	count := func(name string, stat fs.FileInfo) {
+		if job.Snapshot.unchanged(name, stat) != nil {
+			return
+		}
+		files++
+		if stat.Mode().IsRegular() {
+			bytes += stat.Size()
+		}
+	}
+	for _, content := range job.Spec.Contents {
+		stat, err := os.Stat(content.Path)
+		if err != nil {
+			continue
+		}
+		if !stat.IsDir() {
+			if job.Filter.Excluded(content.Path, false) == "" && job.Filter.Included(content.Path) {
+				count(job.Spec.ArchiveName(content, content.Path), stat)
+			}
+			continue
+		}
+		WalkDir(content.Path, job.Spec.IgnoreFiles, quietLogger, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if job.Filter.Excluded(path, d.IsDir()) != "" {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !job.Filter.Included(path) {
+				return nil
+			}
+			if stat, err := d.Info(); err == nil {
+				count(job.Spec.ArchiveName(content, path), stat)
+			}
+			return nil
+		})
+	}
+	job.Log.Debugf("scan(): %d files, %d bytes", files, bytes)
+	progress.AddTotal(files, bytes)
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Files up to this size are read ahead in full. Larger files are read as
+// they're written to the archive, where waiting on each read matters less.
+const ReadAheadMaxSize = 1 << 20
+
+// How many files each reader may have read ahead of the one being written,
+// which bounds the memory used to ReadAheadMaxSize times this per reader.
+const readAheadPerReader = 8
+
+// The contents of a regular file read ahead of adding it to the archive, along
+// with their digests.
+type readAhead struct {
+	path string
+	size int64
+	// Closed once the file has been read.
+	done chan struct{}
+	// The contents, or nil if the file no longer has the expected size.
+	contents        *bytes.Reader
+	manifestDigests []hash.Hash
+	snapshotDigest  hash.Hash
+	// A failure to open or read the file.
+	err error
+}
+
+// Waits until the file has been read, or the context is cancelled.
+func (ra *readAhead) wait(ctx context.Context) error {
+	select {
+	case <-ra.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reads the file and computes its digests.
+func (job *BackupJob) readAhead(ctx context.Context, ra *readAhead) {
+	defer close(ra.done)
+	if ra.err = ctx.Err(); ra.err != nil {
+		return
+	}
+	fp, err := os.Open(ra.path)
+	if err != nil {
+		ra.err = err
+		return
+	}
+	defer fp.Close()
+	// One byte more than expected, to tell if the file has grown.
+	data := make([]byte, ra.size+1)
+	n, err := io.ReadFull(fp, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		ra.err = err
+		return
+	} else if int64(n) != ra.size {
+		// Leave it to be read as usual, with the same outcome.
+		return
+	}
+	data = data[:n]
+	ra.manifestDigests, ra.snapshotDigest = job.newDigests()
+	for _, digest := range ra.manifestDigests {
+		digest.Write(data)
+	}
+	if ra.snapshotDigest != nil {
+		ra.snapshotDigest.Write(data)
+	}
+	ra.contents = bytes.NewReader(data)
+}
+
+// Reports whether the entry is a small file whose contents will be needed.
+func (job *BackupJob) shouldReadAhead(entry *walkEntry) bool {
+	return entry.err == nil && entry.stat.Mode().IsRegular() &&
+		entry.stat.Size() <= ReadAheadMaxSize &&
+		job.Snapshot.unchanged(entry.name, entry.stat) == nil
+}
+
+// Like backupDir, but walks the directory tree on a goroutine of its own, with
+// the spec's readers reading small files ahead on theirs. The entries are added
+// to the archive on this goroutine in the order they're walked, so the archive
+// is the same as backupDir writes.
+func (job *BackupJob) backupDirReadingAhead(ctx context.Context, content Content) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	depth := job.Spec.Readers * readAheadPerReader
+	entries := make(chan *walkEntry, depth)
+	reads := make(chan *readAhead, depth)
+	// Holds a slot for each file read ahead and not yet written.
+	slots := make(chan struct{}, depth)
+
+	var wg sync.WaitGroup
+	for range job.Spec.Readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ra := range reads {
+				job.readAhead(ctx, ra)
+			}
+		}()
+	}
+	var walkErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(entries)
+		defer close(reads)
+		walkErr = WalkDir(content.Path, job.Spec.IgnoreFiles, job.Log, func(path string, d fs.DirEntry, err error) error {
+			entry, err := job.walkEntry(ctx, content, path, d, err)
+			if entry == nil {
+				return err
+			}
+			if job.shouldReadAhead(entry) {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				entry.contents = &readAhead{path: path, size: entry.stat.Size(), done: make(chan struct{})}
+				reads <- entry.contents
+			}
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if entry.err != nil && job.Spec.OnError != OnErrorSkipFile {
+				// The failure stops the backup once it's reached.
+				return entry.err
+			}
+			return nil
+		})
+	}()
+
+	adder := &dirAdder{job: job}
+	var err error
+	for entry := range entries {
+		if err = adder.add(ctx, entry); err != nil {
+			break
+		}
+		if entry.contents != nil {
+			<-slots
+		}
+	}
+	// Stop the walk and reads if they're still going.
+	cancel()
+	wg.Wait()
+	if err == nil {
+		err = walkErr
+	}
+	return err
+}
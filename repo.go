@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A snapshot as output by the list command in JSON.
+type SnapshotListEntry struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"`
+	Time    time.Time `json:"time"`
+	Members int       `json:"members"`
+	Size    int64     `json:"size"`
+}
+
+// Writes a listing of the snapshots in the repository at dir to w, either as
+// text or as a JSON array of SnapshotListEntry.
+func ListSnapshots(w io.Writer, dir string, asJSON bool) error {
+	repo, err := OpenRepository(dir)
+	if err != nil {
+		return err
+	}
+	snapshots, err := repo.Snapshots()
+	if err != nil {
+		return err
+	}
+	entries := []SnapshotListEntry{}
+	for _, snapshot := range snapshots {
+		entry := SnapshotListEntry{
+			ID:      snapshot.ID,
+			Path:    repo.SnapshotPath(snapshot.ID),
+			Time:    snapshot.Time,
+			Members: len(snapshot.Members),
+		}
+		for _, member := range snapshot.Members {
+			entry.Size += member.Size
+		}
+		if !asJSON {
+			fmt.Fprintf(w, "%s %s %8d members %12d bytes\n", entry.ID,
+				entry.Time.Local().Format("2006-01-02 15:04"), entry.Members, entry.Size)
+		}
+		entries = append(entries, entry)
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	return nil
+}
+
+// Entry point for the prune command, returning the exit status.
+func pruneCommand(args []string) int {
+	var keepLast int
+	fs := options.NewCommandFlagSet("prune", "repository [snapshot ...]",
+		"Removes the named snapshots from the repository, then the chunks no snapshot refers to.")
+	fs.IntVar(&keepLast, "keep-last", 0, "Also remove all but the last `N` snapshots.")
+	options.ParseCommand(fs, args)
+	if fs.NArg() < 1 || keepLast < 0 {
+		fs.Usage()
+		return 64 // EX_USAGE.
+	}
+	if err := Prune(nil, fs.Arg(0), fs.Args()[1:], keepLast); err != nil {
+		Errorf("Pruning %s failed: %v", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+// Removes the snapshots with the given IDs from the repository at dir, along
+// with all but the last keepLast snapshots if it's not zero, and then any
+// chunks that are no longer referred to, logging to log. Shouldn't run while a
+// backup is being written to the repository, since its chunks aren't referred
+// to yet.
+func Prune(log *Logger, dir string, forget []string, keepLast int) error {
+	repo, err := OpenRepository(dir)
+	if err != nil {
+		return err
+	}
+	snapshots, err := repo.Snapshots()
+	if err != nil {
+		return err
+	}
+	for i, id := range forget {
+		// Allow the paths of the manifests too.
+		forget[i] = strings.TrimSuffix(path.Base(id), ".json")
+	}
+	referenced := make(map[string]bool)
+	removed := 0
+	for i, snapshot := range snapshots {
+		if !slices.Contains(forget, snapshot.ID) && (keepLast == 0 || i >= len(snapshots)-keepLast) {
+			for _, member := range snapshot.Members {
+				for _, id := range member.Chunks {
+					referenced[id] = true
+				}
+			}
+			continue
+		}
+		forget = slices.DeleteFunc(forget, func(id string) bool { return id == snapshot.ID })
+		log.Infof("Removing snapshot %s", snapshot.ID)
+		removed++
+		if !options.DryRun {
+			if err := removeSnapshot(repo, snapshot.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if len(forget) > 0 {
+		return fmt.Errorf("no such snapshots: %s", strings.Join(forget, ", "))
+	}
+
+	chunks := 0
+	var freed int64
+	err = fs.WalkDir(os.DirFS(repo.Path), "chunks", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || referenced[d.Name()] || strings.HasSuffix(d.Name(), ".tmp") {
+			// Temporary files may belong to a backup in progress.
+			return err
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		log.Verbosef("Removing chunk %s", d.Name())
+		chunks++
+		freed += stat.Size()
+		if options.DryRun {
+			return nil
+		}
+		return os.Remove(path.Join(repo.Path, name))
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: removed %d snapshots and %d chunks, freeing %d bytes", repo.Path, removed, chunks, freed)
+	return nil
+}
+
+// Removes a snapshot manifest, and any checksums written next to it.
+func removeSnapshot(repo *Repository, id string) error {
+	return removeArchive(repo.SnapshotPath(id))
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Statuses of a backup in its report.
+const (
+	ReportSuccess = "success"
+	// Succeeded, but files were skipped.
+	ReportPartial = "partial"
+	ReportFailed  = "failed"
+)
+
+// A machine readable report of how a backup went, written as JSON.
+type BackupReport struct {
+	Name string `json:"name"`
+	// Path of the archive, with any template expanded.
+	Path     string    `json:"path"`
+	Format   string    `json:"format"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// One of ReportSuccess, ReportPartial, or ReportFailed.
+	Status string `json:"status"`
+	// Why the backup failed.
+	Error string `json:"error,omitempty"`
+	// Set for a dry run, where the counts are what would have been added and
+	// nothing was written.
+	Estimated bool `json:"estimated,omitempty"`
+	Files     int  `json:"files"`
+	Dirs      int  `json:"dirs"`
+	Symlinks  int  `json:"symlinks"`
+	// Bytes of file contents read.
+	BytesRead int64 `json:"bytes_read"`
+	// Size of the archive, or of the chunks and snapshot manifest stored in a
+	// repository. For a dry run, it's estimated as BytesRead, as if nothing
+	// compressed.
+	BytesWritten int64 `json:"bytes_written"`
+	// BytesWritten divided by BytesRead, once both are known.
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+	// Files left out under the skip-file policy.
+	Skipped []ReportedPath `json:"skipped"`
+	// The file that failed the backup, if that's why it failed.
+	Failed []ReportedPath `json:"failed"`
+	// SHA-256 of the archive, or of the snapshot manifest for a repository.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// A path in a BackupReport, with the reason it's there.
+type ReportedPath struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Returns the ReportedPath for a failure to read a file.
+func reportedPath(ferr *FileError) ReportedPath {
+	reason := ferr.Err.Error()
+	// Leave out the path repeated by errors from the os package.
+	var perr *fs.PathError
+	if errors.As(ferr.Err, &perr) && perr.Path == ferr.Path {
+		reason = perr.Op + ": " + perr.Err.Error()
+	}
+	return ReportedPath{ferr.Path, reason}
+}
+
+// Returns ReportSuccess, ReportPartial, or ReportFailed, given the error backup
+// returned.
+func (job *BackupJob) status(err error) string {
+	if err != nil {
+		return ReportFailed
+	} else if len(job.Skipped) > 0 {
+		return ReportPartial
+	}
+	return ReportSuccess
+}
+
+// Returns the report for the job, given the error backup returned.
+func (job *BackupJob) Report(err error) *BackupReport {
+	report := &BackupReport{
+		Name:      job.Spec.Name,
+		Path:      job.Spec.Path,
+		Format:    job.Spec.Format,
+		Started:   job.Started,
+		Finished:  time.Now(),
+		Status:    job.status(err),
+		Estimated: options.DryRun,
+		Files:     job.Stats.Files,
+		Dirs:      job.Stats.Dirs,
+		Symlinks:  job.Stats.Symlinks,
+		BytesRead: job.Stats.BytesRead,
+		Skipped:   []ReportedPath{},
+		Failed:    []ReportedPath{},
+	}
+	for _, ferr := range job.Skipped {
+		report.Skipped = append(report.Skipped, reportedPath(ferr))
+	}
+	if err != nil {
+		report.Error = err.Error()
+		var ferr *FileError
+		if errors.As(err, &ferr) {
+			report.Failed = append(report.Failed, reportedPath(ferr))
+		}
+		return report
+	}
+	if options.DryRun {
+		report.BytesWritten = report.BytesRead
+		return report
+	}
+	if stat, err := os.Stat(job.Archive.Name()); err == nil {
+		report.BytesWritten = stat.Size()
+	}
+	if repo, ok := job.Archive.(*RepoArchive); ok {
+		report.BytesWritten += repo.stored
+	}
+	if report.BytesRead > 0 {
+		report.CompressionRatio = float64(report.BytesWritten) / float64(report.BytesRead)
+	}
+	if sum, err := sha256File(job.Archive.Name()); err != nil {
+		job.Log.Warningf("Unable to checksum %s for the report: %v", job.Archive.Name(), err)
+	} else {
+		report.SHA256 = sum
+	}
+	return report
+}
+
+// Returns the SHA-256 of the file at the path name, in hex.
+func sha256File(name string) (string, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// Writes v as indented JSON to the file at the path name, replacing it once
+// complete.
+func WriteReport(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fp, err := CreateAtomic(name)
+	if err != nil {
+		return err
+	}
+	if _, err := fp.Write(append(data, '\n')); err != nil {
+		fp.Abort()
+		return err
+	}
+	if err := fp.Commit(); err != nil {
+		fp.Abort()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options controlling how an archive is restored.
+type RestoreOptions struct {
+	// Directory to restore into.
+	Dest string
+	// Allow absolute names and names leading outside of Dest, and writing
+	// through symbolic links.
+	AllowUnsafePaths bool
+	// Restore absolute names relative to Dest.
+	StripLeadingSlash bool
+	// Set ownership from the archive.
+	SameOwner bool
+}
+
+// Entry point for the restore command, returning the exit status.
+func restoreCommand(args []string) int {
+	var ropts RestoreOptions
+	var asOf time.Time
+	fs := options.NewCommandFlagSet("restore", "archive [dest]",
+		"Restores the contents of the archive into dest, the current directory by default.\n"+
+			"With -as-of, archive is instead a directory of archives or a catalog of a backup chain.")
+	fs.Func("as-of", "Restore the chain of full, incremental, and differential backups needed to recreate the state at `TIME`.",
+		func(arg string) error {
+			var err error
+			asOf, err = ParseTimestamp(arg)
+			return err
+		})
+	fs.BoolVar(&ropts.AllowUnsafePaths, "allow-unsafe-paths", false,
+		"Restore absolute names and names containing \"..\" that may write outside of dest.")
+	fs.BoolVar(&ropts.StripLeadingSlash, "strip-leading-slash", false,
+		"Restore absolute names relative to dest.")
+	fs.BoolVar(&ropts.SameOwner, "same-owner", os.Geteuid() == 0,
+		"Restore the ownership recorded in the archive. Defaults to true when run as root.")
+	options.ParseCommand(fs, args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 64 // EX_USAGE.
+	}
+	ropts.Dest = "."
+	if fs.NArg() == 2 {
+		ropts.Dest = fs.Arg(1)
+	}
+	var err error
+	if asOf.IsZero() {
+		err = Restore(fs.Arg(0), &ropts)
+	} else {
+		err = RestoreAsOf(fs.Arg(0), asOf, &ropts)
+	}
+	if err != nil {
+		Errorf("Restoring %s failed: %v", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+// Restores the archive at the path name into ropts.Dest. Members that can't be
+// restored are reported and skipped, with an error returned at the end.
+func Restore(name string, ropts *RestoreOptions) error {
+	ar, err := OpenArchive(name)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+	r := newRestorer(ropts)
+	if err := r.restoreArchive(ar); err != nil {
+		return err
+	}
+	return r.finish()
+}
+
+// Tracks the state of a restore across one or more archives.
+type restorer struct {
+	*RestoreOptions
+	// Directories restored, whose metadata is set once their contents have
+	// been written. Keyed by target so that a later archive in a chain
+	// replaces what an earlier one restored.
+	dirs map[string]*ArchiveEntry
+	// Number of members that couldn't be restored.
+	failures int
+	// Cached lookups of owner names.
+	uids map[string]int
+	gids map[string]int
+}
+
+func newRestorer(ropts *RestoreOptions) *restorer {
+	return &restorer{
+		RestoreOptions: ropts,
+		dirs:           make(map[string]*ArchiveEntry),
+		uids:           make(map[string]int),
+		gids:           make(map[string]int),
+	}
+}
+
+// Restores every member of the archive.
+func (r *restorer) restoreArchive(ar ArchiveReader) error {
+	for {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", ar.Name(), err)
+		}
+		if err := r.restoreEntry(ar, entry); err != nil {
+			Errorf("%s:%s: %v", ar.Name(), entry.Name, err)
+			r.failures++
+		}
+	}
+}
+
+// Sets the metadata of the restored directories, deepest first so that
+// restrictive permissions don't get in the way, and reports any failures.
+func (r *restorer) finish() error {
+	targets := make([]string, 0, len(r.dirs))
+	for target := range r.dirs {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		di, dj := strings.Count(targets[i], "/"), strings.Count(targets[j], "/")
+		if di != dj {
+			return di > dj
+		}
+		return targets[i] < targets[j]
+	})
+	for _, target := range targets {
+		if !r.AllowUnsafePaths {
+			// Something restored since may have been put in its place.
+			if stat, err := os.Lstat(target); err != nil || !stat.IsDir() {
+				Errorf("%s: no longer a directory", target)
+				r.failures++
+				continue
+			}
+		}
+		if err := r.setMetadata(target, r.dirs[target]); err != nil {
+			Errorf("%s: %v", target, err)
+			r.failures++
+		}
+	}
+	clear(r.dirs)
+	if r.failures > 0 {
+		return fmt.Errorf("%d members could not be restored", r.failures)
+	}
+	return nil
+}
+
+// Returns where the member name should be restored to, refusing unsafe names.
+func (r *restorer) target(name string) (string, error) {
+	if r.StripLeadingSlash {
+		name = strings.TrimLeft(name, "/")
+	}
+	if path.IsAbs(name) {
+		if !r.AllowUnsafePaths {
+			return "", fmt.Errorf("refusing to restore absolute name %q", name)
+		}
+		return path.Clean(name), nil
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		if !r.AllowUnsafePaths {
+			return "", fmt.Errorf("refusing to restore %q outside of %s", name, r.Dest)
+		}
+	} else if !r.AllowUnsafePaths {
+		// A symbolic link restored earlier could otherwise redirect this
+		// member outside of the destination.
+		dir := r.Dest
+		parents := strings.Split(clean, "/")
+		for _, elem := range parents[:len(parents)-1] {
+			dir = path.Join(dir, elem)
+			if stat, err := os.Lstat(dir); err == nil && stat.Mode().Type() == fs.ModeSymlink {
+				return "", fmt.Errorf("refusing to restore %q through symbolic link %s", name, dir)
+			}
+		}
+	}
+	return path.Join(r.Dest, clean), nil
+}
+
+// Removes what an incremental backup recorded as deleted since the backup
+// before it, given the reader positioned at the IncrementalMemberName member.
+func (r *restorer) replayDeletions(ar ArchiveReader) error {
+	var info IncrementalInfo
+	if err := json.NewDecoder(ar).Decode(&info); err != nil {
+		return err
+	}
+	Verbosef("%s: incremental level %d from %v", ar.Name(), info.Level, info.Time)
+	for _, name := range info.Deleted {
+		target, err := r.target(name)
+		if err != nil {
+			Errorf("%s: %v", ar.Name(), err)
+			r.failures++
+			continue
+		}
+		if options.DryRun {
+			Infof("rm %s", target)
+			continue
+		}
+		Verbosef("rm %s", target)
+		if err := os.RemoveAll(target); err != nil {
+			Errorf("%s: %v", ar.Name(), err)
+			r.failures++
+		}
+		// Restored directories that are gone don't need their metadata set.
+		for dir := range r.dirs {
+			if dir == target || strings.HasPrefix(dir, target+"/") {
+				delete(r.dirs, dir)
+			}
+		}
+	}
+	return nil
+}
+
+// Restores the current member of the archive.
+func (r *restorer) restoreEntry(ar ArchiveReader, entry *ArchiveEntry) error {
+	Debugf("restoreEntry(): name: %q mode: %v size: %d link: %q", entry.Name, entry.Mode, entry.Size, entry.Linkname)
+	if IsIncrementalMember(entry.Name) && entry.Mode.IsRegular() {
+		return r.replayDeletions(ar)
+	}
+	target, err := r.target(entry.Name)
+	if err != nil {
+		return err
+	}
+	if options.DryRun {
+		Infof("x %s", target)
+		return nil
+	}
+	Verbosef("x %s", target)
+	if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	switch {
+	case entry.Mode.IsDir():
+		if !r.AllowUnsafePaths {
+			// Otherwise a symbolic link in its place, such as one restored
+			// earlier, would have the directory's metadata set on whatever it
+			// points to.
+			if err := replaceSymlink(target); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(target, 0700); err != nil {
+			return err
+		}
+		if !r.AllowUnsafePaths {
+			if stat, err := os.Lstat(target); err != nil {
+				return err
+			} else if !stat.IsDir() {
+				return fmt.Errorf("%s: not a directory", target)
+			}
+		}
+		r.dirs[target] = entry
+		return nil
+	case entry.HardLink:
+		source, err := r.target(entry.Linkname)
+		if err != nil {
+			return err
+		}
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		return os.Link(source, target)
+	case entry.Mode.Type() == fs.ModeSymlink:
+		linkname := entry.Linkname
+		if linkname == "" {
+			// Formats like zip store the target as the contents.
+			data, err := io.ReadAll(ar)
+			if err != nil {
+				return err
+			}
+			linkname = string(data)
+		}
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(linkname, target); err != nil {
+			return err
+		}
+		if r.SameOwner && entry.HasOwner {
+			return os.Lchown(target, r.uid(entry), r.gid(entry))
+		}
+		return nil
+	case entry.Mode.IsRegular():
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		fp, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		err = CopyData(fp, target, ar, fmt.Sprintf("%s:%s", ar.Name(), entry.Name))
+		if cerr := fp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		return r.setMetadata(target, entry)
+	default:
+		Warningf("Skipping %s: unsupported file type %v", entry.Name, entry.Mode.Type())
+		return nil
+	}
+}
+
+// Removes target if it's a symbolic link.
+func replaceSymlink(target string) error {
+	stat, err := os.Lstat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if stat.Mode().Type() != fs.ModeSymlink {
+		return nil
+	}
+	return os.Remove(target)
+}
+
+// Removes whatever is at target so it can be replaced, unless it is a
+// directory.
+func removeExisting(target string) error {
+	stat, err := os.Lstat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		return fmt.Errorf("%s: is a directory", target)
+	}
+	return os.Remove(target)
+}
+
+// Applies the ownership, permissions, and modification time of the member to
+// target. Ownership comes first as changing it clears set-id bits.
+func (r *restorer) setMetadata(target string, entry *ArchiveEntry) error {
+	if r.SameOwner && entry.HasOwner {
+		if err := os.Lchown(target, r.uid(entry), r.gid(entry)); err != nil {
+			return err
+		}
+	}
+	mode := entry.Mode & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if err := os.Chmod(target, mode); err != nil {
+		return err
+	}
+	return os.Chtimes(target, entry.ModTime, entry.ModTime)
+}
+
+// Returns the user ID for the member, preferring its owner name if that
+// exists on this system.
+func (r *restorer) uid(entry *ArchiveEntry) int {
+	if entry.Uname == "" {
+		return entry.Uid
+	}
+	if uid, ok := r.uids[entry.Uname]; ok {
+		return uid
+	}
+	uid := entry.Uid
+	if u, err := user.Lookup(entry.Uname); err == nil {
+		if id, err := strconv.Atoi(u.Uid); err == nil {
+			uid = id
+		}
+	}
+	r.uids[entry.Uname] = uid
+	return uid
+}
+
+// Returns the group ID for the member, preferring its group name if that
+// exists on this system.
+func (r *restorer) gid(entry *ArchiveEntry) int {
+	if entry.Gname == "" {
+		return entry.Gid
+	}
+	if gid, ok := r.gids[entry.Gname]; ok {
+		return gid
+	}
+	gid := entry.Gid
+	if g, err := user.LookupGroup(entry.Gname); err == nil {
+		if id, err := strconv.Atoi(g.Gid); err == nil {
+			gid = id
+		}
+	}
+	r.gids[entry.Gname] = gid
+	return gid
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a tar archive at name holding members with the given headers and no
+// contents.
+func writeTestTar(t *testing.T, name string, headers ...*tar.Header) {
+	t.Helper()
+	fp, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(fp)
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A directory member named like a symbolic link restored before it mustn't
+// set its metadata on whatever the link points to.
+func TestRestoreDirOverSymlink(t *testing.T) {
+	tmp := t.TempDir()
+	outside := filepath.Join(tmp, "outside")
+	if err := os.Mkdir(outside, 0700); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(tmp, "evil.tar")
+	writeTestTar(t, name,
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "x", Linkname: outside, Mode: 0777},
+		&tar.Header{Typeflag: tar.TypeDir, Name: "x/", Mode: 0777, ModTime: time.Unix(0, 0)},
+	)
+
+	dest := filepath.Join(tmp, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(name, &RestoreOptions{Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.Stat(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode() != before.Mode() {
+		t.Errorf("mode of %s changed from %v to %v", outside, before.Mode(), after.Mode())
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("modification time of %s changed from %v to %v", outside, before.ModTime(), after.ModTime())
+	}
+	stat, err := os.Lstat(filepath.Join(dest, "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.IsDir() {
+		t.Errorf("%s is %v, not a directory", filepath.Join(dest, "x"), stat.Mode().Type())
+	}
+	if stat.Mode().Perm() != fs.FileMode(0777) {
+		t.Errorf("%s has mode %v", filepath.Join(dest, "x"), stat.Mode())
+	}
+}
+
+// Restoring a chain leaves directories with the metadata of the last archive
+// holding them, including their parents.
+func TestRestoreAsOfDirMetadata(t *testing.T) {
+	tmp := t.TempDir()
+	full := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	incr := full.Add(24 * time.Hour)
+
+	fullName := filepath.Join(tmp, "full.tar")
+	writeTestTar(t, fullName,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "d/", Mode: 0755, ModTime: full},
+		&tar.Header{Typeflag: tar.TypeDir, Name: "d/e/", Mode: 0755, ModTime: full},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "d/e/f", Mode: 0644, ModTime: full},
+	)
+	incrName := filepath.Join(tmp, "incr.tar")
+	writeTestTar(t, incrName,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "d/", Mode: 0750, ModTime: incr},
+		&tar.Header{Typeflag: tar.TypeDir, Name: "d/e/", Mode: 0700, ModTime: incr},
+	)
+
+	catalog := filepath.Join(tmp, "catalog.json")
+	state := SnapshotState{
+		Time:  incr,
+		Level: 1,
+		Chain: []SnapshotArchive{
+			{Path: fullName, Level: 0, Time: full},
+			{Path: incrName, Level: 1, Time: incr, Base: &full},
+		},
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(catalog, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(tmp, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreAsOf(catalog, incr, &RestoreOptions{Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mode := range map[string]fs.FileMode{"d": 0750, "d/e": 0700} {
+		stat, err := os.Lstat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Mode().Perm() != mode {
+			t.Errorf("%s has mode %v, want %v", name, stat.Mode().Perm(), mode)
+		}
+		if !stat.ModTime().Equal(incr) {
+			t.Errorf("%s has modification time %v, want %v", name, stat.ModTime(), incr)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A backup that a retention policy applies to.
+type RetentionCandidate struct {
+	// Path of the archive, or the ID of a repository snapshot.
+	Name string
+	Time time.Time
+}
+
+// Returns the reasons each candidate is kept, by index. Those without any are
+// to be removed. The candidates must be sorted newest first.
+func (policy *RetentionSpec) Apply(candidates []RetentionCandidate) map[int][]string {
+	keep := make(map[int][]string)
+	for i := 0; i < policy.KeepLast && i < len(candidates); i++ {
+		keep[i] = append(keep[i], "last")
+	}
+	rules := []struct {
+		reason string
+		count  int
+		period func(time.Time) string
+	}{
+		{"daily", policy.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"monthly", policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"yearly", policy.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, rule := range rules {
+		last := ""
+		kept := 0
+		for i := 0; i < len(candidates) && kept < rule.count; i++ {
+			if period := rule.period(candidates[i].Time.Local()); period != last {
+				keep[i] = append(keep[i], rule.reason)
+				last = period
+				kept++
+			}
+		}
+	}
+	return keep
+}
+
+// Reports whether the policy keeps anything, which means it's in effect.
+func (policy *RetentionSpec) Enabled() bool {
+	return policy != nil && policy.KeepLast+policy.KeepDaily+policy.KeepWeekly+policy.KeepMonthly+policy.KeepYearly > 0
+}
+
+// Removes the spec's archives that its retention policy doesn't keep, never
+// including the archive just written. For the repo format, that's the
+// snapshots in the repository.
+func (job *BackupJob) applyRetention() error {
+	policy := job.Spec.Retention
+	if !policy.Enabled() {
+		return nil
+	}
+	var candidates []RetentionCandidate
+	var err error
+	current := job.Archive.Name()
+	if job.Spec.Format == FormatRepo {
+		if options.DryRun && !IsRepository(job.Spec.Path) {
+			// The dry run didn't create it, so there's nothing to remove.
+			return nil
+		}
+		candidates, err = snapshotCandidates(job.Spec.Path)
+		current = strings.TrimSuffix(filepath.Base(current), ".json")
+	} else {
+		pattern, match := policy.Pattern, (*regexp.Regexp)(nil)
+		if pattern == "" {
+			pattern, match = job.PathGlob, job.PathMatch
+		}
+		candidates, err = archiveCandidates(pattern, match)
+	}
+	if err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	remove := job.expired(candidates, current)
+	if len(remove) == 0 {
+		return nil
+	}
+	if job.Spec.Format == FormatRepo {
+		return Prune(job.Log, job.Spec.Path, remove, 0)
+	}
+	for _, name := range remove {
+		job.Log.Infof("Removing %s", name)
+		if options.DryRun {
+			continue
+		}
+		if err := removeArchive(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the names of the candidates that the spec's retention policy doesn't
+// keep, given the name of the archive just written. Archives in the snapshot's
+// chain are always kept, since restoring later backups needs them.
+func (job *BackupJob) expired(candidates []RetentionCandidate, current string) []string {
+	// A dry run doesn't write a readable archive, but it still counts.
+	found := slices.ContainsFunc(candidates, func(c RetentionCandidate) bool {
+		return sameFile(c.Name, current)
+	})
+	if !found {
+		candidates = append(candidates, RetentionCandidate{Name: current, Time: time.Now()})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Time.After(candidates[j].Time)
+	})
+
+	var remove []string
+	chain := job.Snapshot.Chain()
+	keep := job.Spec.Retention.Apply(candidates)
+	for i, candidate := range candidates {
+		reasons := keep[i]
+		if sameFile(candidate.Name, current) {
+			reasons = append(reasons, "current")
+		}
+		if slices.ContainsFunc(chain, func(a SnapshotArchive) bool { return sameFile(a.Path, candidate.Name) }) {
+			reasons = append(reasons, "chain")
+		}
+		if len(reasons) > 0 {
+			job.Log.Detailf("Keeping %s (%s)", candidate.Name, strings.Join(reasons, ", "))
+		} else {
+			remove = append(remove, candidate.Name)
+		}
+	}
+	return remove
+}
+
+// Returns the archives matching pattern, and match if not nil, ignoring
+// anything that isn't an archive, such as manifests written next to them.
+func archiveCandidates(pattern string, match *regexp.Regexp) ([]RetentionCandidate, error) {
+	names, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []RetentionCandidate
+	for _, name := range names {
+		if match != nil && !match.MatchString(name) {
+			Debugf("archiveCandidates(): skipping %s: not from the spec's path", name)
+			continue
+		}
+		stat, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.Mode().IsRegular() {
+			continue
+		}
+		if _, err := DetectFormat(name); err != nil {
+			Debugf("archiveCandidates(): skipping %s: %v", name, err)
+			continue
+		}
+		candidates = append(candidates, RetentionCandidate{Name: name, Time: stat.ModTime()})
+	}
+	return candidates, nil
+}
+
+// Returns the snapshots of the repository at dir.
+func snapshotCandidates(dir string) ([]RetentionCandidate, error) {
+	repo, err := OpenRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := repo.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []RetentionCandidate
+	for _, snapshot := range snapshots {
+		candidates = append(candidates, RetentionCandidate{Name: snapshot.ID, Time: snapshot.Time})
+	}
+	return candidates, nil
+}
+
+// Reports whether the paths a and b name the same file.
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// Removes an archive along with any manifests and digests written next to it,
+// which are named after the archive with an algorithm's name or tool as the
+// extension.
+func removeArchive(name string) error {
+	for _, alg := range HashAlgorithms {
+		for _, sidecar := range []string{name + "." + alg.Name, name + "." + alg.Tool} {
+			if err := os.Remove(sidecar); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return os.Remove(name)
+}
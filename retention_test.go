@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetentionApply(t *testing.T) {
+	// Two backups a day from 2026-03-01 for two weeks, newest first.
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	var candidates []RetentionCandidate
+	for i := 27; i >= 0; i-- {
+		when := start.Add(time.Duration(i) * 12 * time.Hour)
+		candidates = append(candidates, RetentionCandidate{Name: when.Format(time.RFC3339), Time: when})
+	}
+	tests := []struct {
+		policy RetentionSpec
+		want   map[int][]string
+	}{
+		{RetentionSpec{}, map[int][]string{}},
+		{RetentionSpec{KeepLast: 3}, map[int][]string{
+			0: {"last"}, 1: {"last"}, 2: {"last"},
+		}},
+		{RetentionSpec{KeepDaily: 3}, map[int][]string{
+			0: {"daily"}, 2: {"daily"}, 4: {"daily"},
+		}},
+		// Weeks start on Monday, and 2026-03-01 is a Sunday.
+		{RetentionSpec{KeepLast: 1, KeepWeekly: 3}, map[int][]string{
+			0: {"last", "weekly"}, 12: {"weekly"}, 26: {"weekly"},
+		}},
+		{RetentionSpec{KeepMonthly: 5, KeepYearly: 1}, map[int][]string{
+			0: {"monthly", "yearly"},
+		}},
+	}
+	for _, test := range tests {
+		got := test.policy.Apply(candidates)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v.Apply() = %v, want %v", test.policy, got, test.want)
+		}
+	}
+}
+
+// Archives that later backups in the snapshot chain build upon are kept,
+// whatever the policy.
+func TestRetentionKeepsChain(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2026, 3, n, 0, 0, 0, 0, time.Local)
+	}
+	var candidates []RetentionCandidate
+	for i := 1; i <= 5; i++ {
+		candidates = append(candidates, RetentionCandidate{Name: day(i).Format("2006-01-02") + ".tar", Time: day(i)})
+	}
+	job := &BackupJob{
+		Spec: &BackupSpec{Retention: &RetentionSpec{KeepLast: 1}},
+		Snapshot: &Snapshot{
+			Mode: ModeIncremental,
+			Current: &SnapshotState{Chain: []SnapshotArchive{
+				{Path: "2026-03-03.tar", Level: 0, Time: day(3)},
+				{Path: "2026-03-04.tar", Level: 1, Time: day(4)},
+				{Path: "2026-03-05.tar", Level: 2, Time: day(5)},
+			}},
+		},
+	}
+	got := job.expired(candidates, "2026-03-05.tar")
+	slices.Sort(got)
+	want := []string{"2026-03-01.tar", "2026-03-02.tar"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expired() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Returns a command running the command line with the system's shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Name of the member recording how an incremental backup relates to the ones
+// before it, under the spec's prefix if any. It's the last member added, so
+// restoring the archive can replay the deletions once everything else is done.
+const IncrementalMemberName = ".zephyr/incremental.json"
+
+// The state file of an incremental backup chain, describing what the last
+// backup archived.
+type SnapshotState struct {
+	// When the last backup started.
+	Time time.Time `json:"time"`
+	// Number of incremental backups since the last full one, which is zero.
+	Level int `json:"level"`
+	// The archives making up the chain, starting with the full backup.
+	Chain []SnapshotArchive `json:"chain"`
+	// Everything archived, by name in the archive.
+	Files map[string]*SnapshotFile `json:"files"`
+}
+
+// An archive in a backup chain.
+type SnapshotArchive struct {
+	Path  string    `json:"path"`
+	Level int       `json:"level"`
+	Time  time.Time `json:"time"`
+	// When the backup this one builds upon started, if not a full backup.
+	Base *time.Time `json:"base,omitempty"`
+}
+
+// What was known about a file when it was last archived.
+type SnapshotFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Inode   uint64    `json:"inode,omitempty"`
+	Dir     bool      `json:"dir,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// The contents of the IncrementalMemberName member.
+type IncrementalInfo struct {
+	// Either ModeIncremental or ModeDifferential.
+	Mode string `json:"mode"`
+	// When the backup started.
+	Time time.Time `json:"time"`
+	// Zero for a full backup, otherwise the number of backups since the full
+	// one, which is always one for a differential backup.
+	Level int `json:"level"`
+	// When the backup this one builds upon started, unless a full backup. That
+	// is the previous backup for incremental backups, or the full backup for
+	// differential backups.
+	Base *time.Time `json:"base,omitempty"`
+	// Names archived by the base backup that no longer exist.
+	Deleted []string `json:"deleted"`
+}
+
+// Tracks the changes since the previous backup of a chain while a backup runs.
+type Snapshot struct {
+	// Path of the state file.
+	Path string
+	// Either ModeIncremental or ModeDifferential.
+	Mode string
+	// State the backup is compared with, or nil if this is a full backup.
+	// That's the state after the previous backup for an incremental backup,
+	// and the index of the full backup for a differential backup.
+	Previous *SnapshotState
+	// State being built by this backup.
+	Current *SnapshotState
+	// Where messages go.
+	Log *Logger
+}
+
+// Loads the state file at name to start a new backup in the given mode. If
+// there is no state file or full is set, the backup will be a full backup.
+func LoadSnapshot(log *Logger, name, mode string, full bool, started time.Time) (*Snapshot, error) {
+	snap := &Snapshot{
+		Path: name,
+		Mode: mode,
+		Log:  log,
+		Current: &SnapshotState{
+			Time:  started,
+			Files: make(map[string]*SnapshotFile),
+		},
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Detailf("No snapshot at %s, performing a full backup to start a %s chain", name, mode)
+		return snap, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if full {
+		log.Detailf("Full backup requested, starting a new %s chain in %s", mode, name)
+		return snap, nil
+	}
+	var prev SnapshotState
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	snap.Previous = &prev
+	switch mode {
+	case ModeIncremental:
+		snap.Current.Level = prev.Level + 1
+		snap.Current.Chain = prev.Chain
+		log.Detailf("Incremental backup level %d since %v, using snapshot %s",
+			snap.Current.Level, prev.Time, name)
+	case ModeDifferential:
+		if prev.Level != 0 {
+			return nil, fmt.Errorf("%s: not the index of a full backup, a full backup is needed to start a differential chain", name)
+		}
+		snap.Current.Level = 1
+		reference := "unknown archive"
+		if len(prev.Chain) > 0 {
+			reference = prev.Chain[0].Path
+		}
+		log.Detailf("Differential backup since full backup %s of %v, using index %s",
+			reference, prev.Time, name)
+	default:
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+	return snap, nil
+}
+
+// Reports whether the file is unchanged since the previous backup, in which
+// case it is recorded as still existing and shouldn't be archived again. Always
+// false on a nil Snapshot.
+func (snap *Snapshot) Unchanged(name string, stat fs.FileInfo) bool {
+	prev := snap.unchanged(name, stat)
+	if prev == nil {
+		return false
+	}
+	snap.Current.Files[name] = prev
+	return true
+}
+
+// Returns what the previous backup recorded of the file if it's unchanged
+// since, or nil. Unlike Unchanged, records nothing, so it's safe to call while
+// the backup is being written.
+func (snap *Snapshot) unchanged(name string, stat fs.FileInfo) *SnapshotFile {
+	if snap == nil || snap.Previous == nil || stat.IsDir() {
+		return nil
+	}
+	prev := snap.Previous.Files[name]
+	if prev == nil || prev.Dir || prev.Size != stat.Size() ||
+		!prev.ModTime.Equal(stat.ModTime()) || prev.Inode != inode(stat) {
+		return nil
+	}
+	return prev
+}
+
+// Records the file as archived in this backup. The digest, if not nil, is the
+// SHA-256 of its contents. Does nothing on a nil Snapshot.
+func (snap *Snapshot) Record(name string, stat fs.FileInfo, digest hash.Hash) {
+	if snap == nil {
+		return
+	}
+	file := &SnapshotFile{
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		Inode:   inode(stat),
+		Dir:     stat.IsDir(),
+	}
+	if digest != nil {
+		file.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	}
+	snap.Current.Files[name] = file
+}
+
+// Records the file, and anything beneath it, as the previous backup did,
+// for a file that couldn't be read this time. Otherwise it would be taken for
+// deleted. Does nothing on a nil Snapshot.
+func (snap *Snapshot) Keep(name string) {
+	if snap == nil || snap.Previous == nil {
+		return
+	}
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	if name == "." {
+		prefix = ""
+	}
+	for prevName, file := range snap.Previous.Files {
+		if prevName != name && !strings.HasPrefix(prevName, prefix) {
+			continue
+		}
+		if _, ok := snap.Current.Files[prevName]; !ok {
+			snap.Current.Files[prevName] = file
+		}
+	}
+}
+
+// Returns the names archived by the previous backup that weren't seen by this
+// one, sorted so parents come before their children.
+func (snap *Snapshot) Deleted() []string {
+	deleted := []string{}
+	if snap.Previous == nil {
+		return deleted
+	}
+	for name := range snap.Previous.Files {
+		if _, ok := snap.Current.Files[name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return deleted
+}
+
+// Returns the IncrementalInfo describing this backup.
+func (snap *Snapshot) Info() *IncrementalInfo {
+	info := &IncrementalInfo{
+		Mode:    snap.Mode,
+		Time:    snap.Current.Time,
+		Level:   snap.Current.Level,
+		Deleted: snap.Deleted(),
+	}
+	if snap.Previous != nil {
+		info.Base = &snap.Previous.Time
+	}
+	return info
+}
+
+// Adds the IncrementalInfo member to the archive as name.
+func (snap *Snapshot) AddTo(archive Archive, name string) error {
+	data, err := json.MarshalIndent(snap.Info(), "", "  ")
+	if err != nil {
+		return err
+	}
+	snap.Log.Verbosef("Adding %s info %s", snap.Mode, FormatName(archive, name))
+	stat := &SyntheticFileInfo{
+		FileName:    name,
+		FileSize:    int64(len(data)),
+		FileMode:    0644,
+		FileModTime: snap.Current.Time,
+	}
+	return archive.AddFile(strings.NewReader(string(data)), stat, "", name)
+}
+
+// Writes the state file after the archive has been successfully written. The
+// file is replaced atomically so that a failure leaves the previous state.
+// Differential backups only add the archive to the chain of the full backup's
+// index, which remains the reference for later backups.
+func (snap *Snapshot) Save(archive string) error {
+	entry := SnapshotArchive{
+		Path:  archive,
+		Level: snap.Current.Level,
+		Time:  snap.Current.Time,
+	}
+	state := snap.Current
+	if snap.Previous != nil {
+		entry.Base = &snap.Previous.Time
+		if snap.Mode == ModeDifferential {
+			state = snap.Previous
+		}
+	}
+	state.Chain = append(state.Chain, entry)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(snap.Path), 0755); err != nil {
+		return err
+	}
+	fp, err := CreateAtomic(snap.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := fp.Write(data); err != nil {
+		fp.Abort()
+		return err
+	}
+	snap.Log.Verbosef("Updating snapshot %s", snap.Path)
+	return fp.Commit()
+}
+
+// Returns the archives of the chain the backup belongs to, as the state file
+// records them. Nil on a nil Snapshot.
+func (snap *Snapshot) Chain() []SnapshotArchive {
+	if snap == nil {
+		return nil
+	}
+	if snap.Mode == ModeDifferential && snap.Previous != nil {
+		return snap.Previous.Chain
+	}
+	return snap.Current.Chain
+}
+
+// Reports whether the member name is an IncrementalMemberName.
+func IsIncrementalMember(name string) bool {
+	return name == IncrementalMemberName || strings.HasSuffix(name, "/"+IncrementalMemberName)
+}
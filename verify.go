@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Zlib
+// Copyright 2026, Terry M. Poulin.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Options controlling how an archive is verified.
+type VerifyOptions struct {
+	// Name to report the archive as, if not the path it's read from.
+	DisplayName string
+	// Directory to compare the members against, if not empty. Absolute names
+	// are taken relative to it.
+	CompareDir string
+	// Names of the members expected to be in the archive, if not nil. Names
+	// of directories don't include the trailing slash.
+	Expected map[string]bool
+	// Where messages go.
+	Log *Logger
+}
+
+// Entry point for the verify command, returning the exit status.
+func verifyCommand(args []string) int {
+	var vopts VerifyOptions
+	fs := options.NewCommandFlagSet("verify", "archive ...",
+		"Verifies the archives can be read back, checking the integrity checks provided by the format.")
+	fs.StringVar(&vopts.CompareDir, "compare", "",
+		"Compare the size, modification time, and contents of each member with the files in `DIR`.")
+	options.ParseCommand(fs, args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 64 // EX_USAGE.
+	}
+	status := 0
+	for _, name := range fs.Args() {
+		if err := Verify(name, &vopts); err != nil {
+			Errorf("Verifying %s failed: %v", name, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// Reads every member of the archive at the path name, checking that it
+// decodes and passes the integrity checks of the format, such as the CRCs of
+// zip and the trailers of gzip. Problems are reported as they are found, and
+// summarized by the returned error.
+func Verify(name string, vopts *VerifyOptions) error {
+	format, err := DetectFormat(name)
+	if err != nil {
+		return err
+	}
+	ar, err := format.Open(name)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+	if vopts.DisplayName != "" {
+		name = vopts.DisplayName
+	}
+
+	problems := 0
+	problem := func(format string, args ...any) {
+		vopts.Log.Errorf(format, args...)
+		problems++
+	}
+	// Zip archives store what symbolic links point to, as regular members.
+	followLinks := slices.Contains(format.Names, FormatZip)
+	seen := make(map[string]bool)
+	members := 0
+	for {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// There's no recovering from a corrupt stream.
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		members++
+		member := fmt.Sprintf("%s:%s", name, entry.Name)
+		seen[strings.TrimSuffix(entry.Name, "/")] = true
+
+		var digest hash.Hash
+		w := io.Discard
+		if vopts.CompareDir != "" && entry.Mode.IsRegular() && !entry.HardLink {
+			digest = sha256.New()
+			w = digest
+		}
+		n, err := io.Copy(w, ar)
+		if err != nil {
+			return fmt.Errorf("%s: %w", member, err)
+		}
+		if entry.Mode.IsRegular() && !entry.HardLink && n != entry.Size {
+			problem("%s: read %d bytes, expected %d", member, n, entry.Size)
+		}
+		vopts.Log.Verbosef("ok %s", member)
+
+		if vopts.CompareDir != "" {
+			for _, msg := range compareEntry(entry, vopts.CompareDir, digest, followLinks) {
+				problem("%s: %s", member, msg)
+			}
+		}
+	}
+	for expected := range vopts.Expected {
+		if !seen[expected] {
+			problem("%s: missing %s", name, expected)
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problems found in %d members", problems, members)
+	}
+	vopts.Log.Infof("%s: %d members verified", name, members)
+	return nil
+}
+
+// Compares the entry with the file of the same name in dir, returning a
+// description of each difference. The digest, if not nil, is the SHA-256 of
+// the entry's contents. With followLinks, a symbolic link is compared as the
+// file it points to, for formats that archive links that way.
+func compareEntry(entry *ArchiveEntry, dir string, digest hash.Hash, followLinks bool) []string {
+	source := path.Join(dir, strings.TrimLeft(path.Clean(entry.Name), "/"))
+	stat, err := os.Lstat(source)
+	if err == nil && followLinks && stat.Mode().Type() == fs.ModeSymlink {
+		stat, err = os.Stat(source)
+	}
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var diffs []string
+	if !entry.HardLink && stat.Mode().Type() != entry.Mode.Type() {
+		diffs = append(diffs, fmt.Sprintf("type differs from %s", source))
+		return diffs
+	}
+	switch {
+	case entry.Mode.Type() == fs.ModeSymlink:
+		if target, err := os.Readlink(source); err != nil {
+			diffs = append(diffs, err.Error())
+		} else if target != entry.Linkname {
+			diffs = append(diffs, fmt.Sprintf("links to %q, but %s links to %q", entry.Linkname, source, target))
+		}
+	case entry.Mode.IsRegular() && digest != nil:
+		if stat.Size() != entry.Size {
+			diffs = append(diffs, fmt.Sprintf("size %d differs from %s size %d", entry.Size, source, stat.Size()))
+		}
+		// Archive formats commonly round to whole seconds.
+		mtime := stat.ModTime().Truncate(time.Second)
+		if !mtime.Equal(entry.ModTime.Truncate(time.Second)) {
+			diffs = append(diffs, fmt.Sprintf("modified %v, but %s modified %v", entry.ModTime, source, stat.ModTime()))
+		}
+		sum, err := hashFile(source)
+		if err != nil {
+			diffs = append(diffs, err.Error())
+		} else if !bytes.Equal(sum, digest.Sum(nil)) {
+			diffs = append(diffs, fmt.Sprintf("contents differ from %s", source))
+		}
+	}
+	return diffs
+}
+
+// Returns the SHA-256 of the file's contents.
+func hashFile(name string) ([]byte, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, fp); err != nil {
+		return nil, err
+	}
+	return digest.Sum(nil), nil
+}
@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: Zlib
-// Copyright 2024, Terry M. Poulin.
+// Copyright 2024-2026, Terry M. Poulin.
 
 package main
 
@@ -14,14 +14,20 @@ import (
 // Note well that fn will be called with the complete path as its first
 // parameter, but the directory entry provided will not be. E.g., "subdir/foo"
 // versus "foo".
-func WalkDir(root string, fn fs.WalkDirFunc) error {
+//
+// Any files named in ignoreFiles that are found in a directory are read for
+// .gitignore style rules, which apply to that directory and those beneath it.
+// Ignored paths are never passed to fn, and are logged to log. Failing to read
+// them is passed to fn like failing to read the directory, since there's no
+// telling what in it is ignored.
+func WalkDir(root string, ignoreFiles []string, log *Logger, fn fs.WalkDirFunc) error {
 	rstat, err := os.Stat(root)
 	if err != nil {
 		// If the initial Stat on the root directory fails, fs.WalkDir calls fn(root, nil, stat err).
 		err = fn(root, nil, err)
 	} else {
 		// Otherwise fs.WalkDir calls its recursive descent function.
-		err = walkDir(root, fs.FileInfoToDirEntry(rstat), fn)
+		err = walkDir(root, fs.FileInfoToDirEntry(rstat), nil, ignoreFiles, log, fn)
 	}
 	if err == fs.SkipDir || err == fs.SkipAll {
 		return nil
@@ -31,8 +37,9 @@ func WalkDir(root string, fn fs.WalkDirFunc) error {
 
 // Helper function similar to fs.walkDir(), but implemented without the FS that
 // hates symlinks. We call leave it to os.ReadDir() and the walkDirFn() to
-// decide what happens with symlinks.
-func walkDir(name string, d fs.DirEntry, walkDirFn fs.WalkDirFunc) error {
+// decide what happens with symlinks. The rules are those inherited from the
+// parent directories.
+func walkDir(name string, d fs.DirEntry, rules *IgnoreRules, ignoreFiles []string, log *Logger, walkDirFn fs.WalkDirFunc) error {
 	// Execute the handler for the current entry.
 	err := walkDirFn(name, d, nil)
 	if err != nil || !d.IsDir() {
@@ -40,7 +47,7 @@ func walkDir(name string, d fs.DirEntry, walkDirFn fs.WalkDirFunc) error {
 		if err == fs.SkipDir && d.IsDir() {
 			err = nil
 		}
-		return nil
+		return err
 	}
 	dentries, err := os.ReadDir(name)
 	if err != nil {
@@ -53,11 +60,25 @@ func walkDir(name string, d fs.DirEntry, walkDirFn fs.WalkDirFunc) error {
 		}
 		return err
 	}
+	if len(ignoreFiles) > 0 {
+		rules, err = rules.Load(name, ignoreFiles)
+		if err != nil {
+			err = walkDirFn(name, d, err)
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
 	for _, dent := range dentries {
 		// The fully qualified path, relative to where we started.
 		name := path.Join(name, dent.Name())
+		if ignored, source := rules.Ignored(name, dent.IsDir()); ignored {
+			log.Detailf("Ignoring %s (%s)", name, source)
+			continue
+		}
 		// Call the function with whatever file or dir we found.
-		err = walkDir(name, dent, walkDirFn)
+		err = walkDir(name, dent, rules, ignoreFiles, log, walkDirFn)
 		if err != nil {
 			if err == fs.SkipDir {
 				// Done with this leaf.